@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+// Header to call the API as a subuser
+const OnBehalfOfHeader = "On-Behalf-Of"
+
+// Context key of the username of the authorized subuser
+const subuserKey = "auth.subuser"
+
+// Check "Authorization: Bearer <API key>", the scope of the API key and the subuser of the on-behalf-of header.
+// SENDGRID_DEV_API_KEY has full access, the other keys are managed by /v3/api_keys.
+// The status is 401 for an invalid key or an unknown subuser, and 403 for a missing scope or a disabled subuser like SendGrid.
+func Authorize(c echo.Context, scope string) (int, model.ErrorResponse, bool) {
+	authorization := c.Request().Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return unauthorized()
+	}
+	secret := strings.TrimPrefix(authorization, "Bearer ")
+	if secret != instance.From(c).Getenv("SENDGRID_DEV_API_KEY") {
+		key, ok := instance.From(c).APIKeys.Find(secret)
+		if !ok {
+			return unauthorized()
+		}
+		if !key.HasScope(scope) {
+			return forbidden()
+		}
+	}
+
+	if onBehalfOf := c.Request().Header.Get(OnBehalfOfHeader); onBehalfOf != "" {
+		subuser, ok := instance.From(c).Subusers.Get(onBehalfOf)
+		if !ok {
+			return unauthorized()
+		}
+		if subuser.Disabled {
+			return forbidden()
+		}
+		c.Set(subuserKey, subuser.Username)
+	}
+	return http.StatusOK, model.ErrorResponse{}, true
+}
+
+// Middleware of the /dev endpoints, which take no API key. The subuser of the on-behalf-of header
+// (or the subuser parameter) must exist, 401 (404 for the parameter) is returned for an unknown subuser.
+func DevSubuser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if onBehalfOf := c.Request().Header.Get(OnBehalfOfHeader); onBehalfOf != "" {
+				subuser, ok := instance.From(c).Subusers.Get(onBehalfOf)
+				if !ok {
+					statusCode, errorResponse, _ := unauthorized()
+					return c.JSON(statusCode, errorResponse)
+				}
+				c.Set(subuserKey, subuser.Username)
+			} else if username := c.QueryParam("subuser"); username != "" {
+				subuser, ok := instance.From(c).Subusers.Get(username)
+				if !ok {
+					return c.JSON(http.StatusNotFound, model.GetErrorResponse("subuser not found", "subuser", nil))
+				}
+				c.Set(subuserKey, subuser.Username)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Get username of the subuser resolved by Authorize or DevSubuser. It is empty for the parent account,
+// so the subuser is only known after the request is authorized.
+func Subuser(c echo.Context) string {
+	subuser, _ := c.Get(subuserKey).(string)
+	return subuser
+}
+
+func forbidden() (int, model.ErrorResponse, bool) {
+	return http.StatusForbidden, model.GetErrorResponse("access forbidden", nil, nil), false
+}
+
+func unauthorized() (int, model.ErrorResponse, bool) {
+	return http.StatusUnauthorized, model.GetErrorResponse("The provided authorization grant is invalid, expired, or revoked", nil, nil), false
+}
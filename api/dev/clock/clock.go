@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type clockResponse struct {
+	Now     int64 `json:"now"`
+	Pending int   `json:"pending"`
+}
+
+type advanceRequest struct {
+	Duration string `json:"duration"`
+}
+
+func GetClock() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		return c.JSON(http.StatusOK, getClock(c))
+	}
+}
+
+// Advance the clock of the scheduler, e.g. {"duration": "1h30m"}. Due scheduled sends are sent at once.
+func PostAdvance() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var request advanceRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration < 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("duration must be a positive duration like \"1h30m\"", "duration", nil))
+		}
+
+		instance.From(c).Scheduler.Advance(duration)
+		return c.JSON(http.StatusOK, getClock(c))
+	}
+}
+
+// Reset the clock to the real time
+func DeleteClock() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		instance.From(c).Scheduler.Reset()
+		return c.JSON(http.StatusOK, getClock(c))
+	}
+}
+
+func getClock(c echo.Context) clockResponse {
+	return clockResponse{Now: instance.From(c).Scheduler.Now().Unix(), Pending: instance.From(c).Scheduler.Pending()}
+}
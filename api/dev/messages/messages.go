@@ -0,0 +1,246 @@
+package messages
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Messages of a subuser are listed with the on-behalf-of header or the subuser parameter (see auth.DevSubuser)
+func GetMessages() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		return c.JSON(http.StatusOK, instance.From(c).Messages.List(getFilter(c)))
+	}
+}
+
+// Export messages matching the filter of GetMessages as an mbox file or a zip archive of a Maildir tree
+func GetMessagesExport() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		format := c.QueryParam("format")
+		if format == "" {
+			format = messages.FormatMbox
+		}
+		list := instance.From(c).Messages.List(getFilter(c))
+
+		switch format {
+		case messages.FormatMbox:
+			c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "messages.mbox"}))
+			c.Response().Header().Set(echo.HeaderContentType, "application/mbox")
+			c.Response().WriteHeader(http.StatusOK)
+			return messages.WriteMbox(c.Response(), list)
+		case messages.FormatMaildir:
+			c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "messages.zip"}))
+			c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+			c.Response().WriteHeader(http.StatusOK)
+			return messages.WriteMaildirZip(c.Response(), "messages", list)
+		}
+		return c.JSON(http.StatusBadRequest, model.GetErrorResponse("format must be one of mbox, maildir", "format", nil))
+	}
+}
+
+func getFilter(c echo.Context) messages.Filter {
+	return messages.Filter{
+		To:       c.QueryParam("to"),
+		From:     c.QueryParam("from"),
+		Subject:  c.QueryParam("subject"),
+		Category: c.QueryParam("category"),
+		Subuser:  auth.Subuser(c),
+	}
+}
+
+// Get message of the id parameter. Subusers get their own messages only.
+func getMessage(c echo.Context) (messages.Message, bool) {
+	message, ok := instance.From(c).Messages.Get(c.Param("id"))
+	if subuser := auth.Subuser(c); ok && subuser != "" && message.Subuser != subuser {
+		return messages.Message{}, false
+	}
+	return message, ok
+}
+
+func GetMessage() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		return c.JSON(http.StatusOK, message)
+	}
+}
+
+func GetMessageRaw() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		return c.Blob(http.StatusOK, "message/rfc822", message.Raw)
+	}
+}
+
+// Raw MIME message as an .eml file to open in a mail client
+func GetMessageEML() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": message.EMLFilename()}))
+		return c.Blob(http.StatusOK, "message/rfc822", message.EML())
+	}
+}
+
+// HTML part for the sandboxed iframe of the web UI. Scripts, forms and plugins are disabled by CSP.
+func GetMessageHTML() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		c.Response().Header().Set("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'")
+		return c.HTML(http.StatusOK, message.HTML)
+	}
+}
+
+func GetMessageHeaders() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		header, err := message.Header()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, model.GetErrorResponse(err.Error(), nil, nil))
+		}
+		return c.JSON(http.StatusOK, header)
+	}
+}
+
+func GetMessageAttachments() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		attachments, err := message.Attachments()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, model.GetErrorResponse(err.Error(), nil, nil))
+		}
+		return c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// Download attachment by index
+func GetMessageAttachment() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		attachments, err := message.Attachments()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, model.GetErrorResponse(err.Error(), nil, nil))
+		}
+		index, err := strconv.Atoi(c.Param("index"))
+		if err != nil || index < 0 || index >= len(attachments) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Attachment not found", "index", nil))
+		}
+
+		attachment := attachments[index]
+		c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		return c.Blob(http.StatusOK, attachment.ContentType, attachment.Content)
+	}
+}
+
+// Original JSON of the /v3/mail/send request
+func GetMessageRequest() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		if len(message.Request) == 0 {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message was not sent by /v3/mail/send", "id", nil))
+		}
+		return c.JSONBlob(http.StatusOK, message.Request)
+	}
+}
+
+func DeleteMessage() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if _, ok := getMessage(c); !ok || !instance.From(c).Messages.Delete(c.Param("id")) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func DeleteMessages() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if subuser := auth.Subuser(c); subuser != "" {
+			// Delete the messages of the subuser only
+			for _, message := range instance.From(c).Messages.List(messages.Filter{Subuser: subuser}) {
+				instance.From(c).Messages.Delete(message.ID)
+			}
+			return c.NoContent(http.StatusNoContent)
+		}
+		instance.From(c).Messages.DeleteAll()
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func GetMessageEvents() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if _, ok := getMessage(c); !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+		return c.JSON(http.StatusOK, instance.From(c).Dispatcher.History(c.Param("id")))
+	}
+}
+
+// Trigger synthetic events, e.g. {"event": "click", "email": "to@example.com", "url": "https://example.com"}.
+// Events are generated for every recipient when email is omitted.
+func PostMessageEvents() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		message, ok := getMessage(c)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "id", nil))
+		}
+
+		var fields map[string]interface{}
+		if err := json.NewDecoder(c.Request().Body).Decode(&fields); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		eventType, _ := fields["event"].(string)
+		if !webhook.IsEventType(eventType) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("event is invalid", "event", nil))
+		}
+		delete(fields, "event")
+
+		var events []webhook.Event
+		if email, _ := fields["email"].(string); email != "" {
+			events = append(events, webhook.NewEvent(eventType, message, email, fields))
+		} else {
+			events = webhook.NewEvents(eventType, message, fields)
+		}
+		instance.From(c).Dispatcher.Publish(events...)
+
+		if list, ok := suppression.EventLists[eventType]; ok {
+			for _, event := range events {
+				reason, _ := event["reason"].(string)
+				status, _ := event["status"].(string)
+				instance.From(c).Suppressions.For(message.Subuser).Add(list, suppression.Suppression{Email: event["email"].(string), Reason: reason, Status: status})
+			}
+		}
+
+		return c.JSON(http.StatusOK, events)
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/stream"
+	"golang.org/x/net/websocket"
+)
+
+// Interval of the keep-alive comments of Server-Sent Events
+const keepAliveInterval = 15 * time.Second
+
+// Push accepted messages and published events with Server-Sent Events, or WebSocket when the connection is upgraded.
+// type, to, category and custom_arg ("key:value") filter the items.
+// Items of a subuser are pushed with the on-behalf-of header or the subuser parameter (see auth.DevSubuser).
+// When a client is too slow to receive the items, the stream ends after the buffered items instead of skipping any,
+// so that the client reconnects (EventSource does it automatically) and reloads /dev/messages for the missed ones.
+func GetStream() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		filter := stream.Filter{
+			Type:      c.QueryParam("type"),
+			To:        c.QueryParam("to"),
+			Category:  c.QueryParam("category"),
+			CustomArg: c.QueryParam("custom_arg"),
+			Subuser:   auth.Subuser(c),
+		}
+		subscriber := instance.From(c).Hub.Subscribe(filter)
+		defer instance.From(c).Hub.Unsubscribe(subscriber)
+
+		if strings.EqualFold(c.Request().Header.Get("Upgrade"), "websocket") {
+			serveWebSocket(c, subscriber)
+			return nil
+		}
+		return serveEvents(c, subscriber)
+	}
+}
+
+func serveEvents(c echo.Context, subscriber *stream.Subscriber) error {
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case item, ok := <-subscriber.C:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(response, "event: %s\ndata: %s\n\n", item.Type, data); err != nil {
+				return nil
+			}
+			response.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(response, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
+
+// Send each item as a JSON text frame until the client closes the connection
+func serveWebSocket(c echo.Context, subscriber *stream.Subscriber) {
+	server := websocket.Server{
+		// Accept every origin like the other /dev endpoints
+		Handshake: func(config *websocket.Config, request *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+			}()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case item, ok := <-subscriber.C:
+					if !ok || websocket.JSON.Send(ws, item) != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+}
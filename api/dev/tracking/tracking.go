@@ -0,0 +1,62 @@
+package tracking
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/tracking"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Transparent 1x1 GIF
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Record the click of a tracked link and redirect to the original URL
+func GetClick() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		token, err := tracking.ParseToken(c.QueryParam("token"), instance.From(c).TokenKey())
+		if err != nil || token.URL == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Invalid link", "token", nil))
+		}
+
+		publish(c, token, "click", map[string]interface{}{
+			"url":        token.URL,
+			"url_offset": map[string]interface{}{"index": token.Index, "type": token.Type},
+		})
+		return c.Redirect(http.StatusFound, token.URL)
+	}
+}
+
+// Record the open of a message by the tracking pixel
+func GetOpen() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if token, err := tracking.ParseToken(c.QueryParam("token"), instance.From(c).TokenKey()); err == nil {
+			publish(c, token, "open", nil)
+		}
+		c.Response().Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		return c.Blob(http.StatusOK, "image/gif", pixel)
+	}
+}
+
+func publish(c echo.Context, token tracking.Token, eventType string, fields map[string]interface{}) {
+	message, ok := instance.From(c).Messages.Get(token.MessageID)
+	if !ok {
+		return
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	if userAgent := c.Request().UserAgent(); userAgent != "" {
+		fields["useragent"] = userAgent
+	}
+	if ip := c.RealIP(); ip != "" {
+		fields["ip"] = ip
+	}
+	instance.From(c).Dispatcher.Publish(webhook.NewEvent(eventType, message, token.Email, fields))
+}
@@ -0,0 +1,194 @@
+"use strict";
+
+const api = "/dev/messages";
+
+let messages = [];
+let selected = null;
+let tab = "html";
+
+function el(tag, attributes, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attributes || {})) {
+    node.setAttribute(name, value);
+  }
+  for (const child of children) {
+    node.append(child);
+  }
+  return node;
+}
+
+function addresses(list) {
+  return (list || []).map((a) => (a.name ? `${a.name} <${a.email}>` : a.email)).join(", ");
+}
+
+function table(rows, headings) {
+  const node = el("table");
+  if (headings) {
+    node.append(el("tr", {}, ...headings.map((heading) => el("th", {}, heading))));
+  }
+  for (const row of rows) {
+    node.append(el("tr", {}, ...row.map((cell) => el("td", {}, cell))));
+  }
+  return node;
+}
+
+async function fetchJSON(path) {
+  const response = await fetch(path);
+  if (!response.ok) {
+    throw new Error(`${path} responded ${response.status}`);
+  }
+  return response.json();
+}
+
+async function loadMessages() {
+  const to = document.getElementById("search").value;
+  const list = await fetchJSON(to ? `${api}?to=${encodeURIComponent(to)}` : api);
+  const changed = list.length !== messages.length || list.some((m, i) => m.id !== messages[i].id);
+  messages = list;
+  document.getElementById("status").textContent = `${messages.length} messages`;
+  if (changed) {
+    renderList();
+  }
+}
+
+function renderList() {
+  const node = document.getElementById("messages");
+  node.replaceChildren();
+  for (const message of [...messages].reverse()) {
+    const item = el(
+      "li",
+      { "data-id": message.id },
+      el("div", { class: "subject" }, message.subject || "(no subject)"),
+      el("div", { class: "meta" }, `To: ${addresses(message.to)}`),
+      el("div", { class: "meta" }, `${addresses([message.from])} - ${new Date(message.created_at).toLocaleString()}`),
+    );
+    if (selected && message.id === selected.id) {
+      item.classList.add("selected");
+    }
+    item.addEventListener("click", () => select(message));
+    node.append(item);
+  }
+}
+
+function select(message) {
+  selected = message;
+  renderList();
+  document.getElementById("message").hidden = false;
+  document.getElementById("summary").replaceChildren(
+    el("h2", {}, message.subject || "(no subject)"),
+    el("div", {}, `From: ${addresses([message.from])}`),
+    el("div", {}, `To: ${addresses(message.to)}`),
+    message.cc && message.cc.length ? el("div", {}, `Cc: ${addresses(message.cc)}`) : "",
+    message.bcc && message.bcc.length ? el("div", {}, `Bcc: ${addresses(message.bcc)}`) : "",
+    el("div", {}, `ID: ${message.id} `, el("a", { href: `${api}/${encodeURIComponent(message.id)}/eml` }, "Download .eml")),
+  );
+  renderTab();
+}
+
+// Keys of substitutions and Handlebars expressions left in the rendered message
+function unreplaced(message) {
+  const rendered = [message.subject, message.html, message.text].join("\n");
+  const keys = Object.keys(message.substitutions || {}).filter((key) => key !== "" && rendered.includes(key));
+  return keys.concat(rendered.match(/{{[^}]*}}/g) || []);
+}
+
+const tabs = {
+  html: (message) =>
+    message.html
+      ? el("iframe", { sandbox: "", src: `${api}/${encodeURIComponent(message.id)}/html`, title: "HTML" })
+      : el("p", {}, "No HTML part"),
+  text: (message) => el("pre", {}, message.text || "No text part"),
+  headers: async (message) => {
+    const headers = await fetchJSON(`${api}/${encodeURIComponent(message.id)}/headers`);
+    return table(headers.map((h) => [h.name, h.value]), ["Name", "Value"]);
+  },
+  raw: async (message) => {
+    const response = await fetch(`${api}/${encodeURIComponent(message.id)}/raw`);
+    return el("pre", {}, await response.text());
+  },
+  attachments: async (message) => {
+    const attachments = await fetchJSON(`${api}/${encodeURIComponent(message.id)}/attachments`);
+    if (attachments.length === 0) {
+      return el("p", {}, "No attachments");
+    }
+    return table(
+      attachments.map((a, i) => [
+        el("a", { href: `${api}/${encodeURIComponent(message.id)}/attachments/${i}`, download: a.filename }, a.filename || `attachment-${i}`),
+        a.type,
+        a.disposition,
+        `${a.size} bytes`,
+      ]),
+      ["Filename", "Type", "Disposition", "Size"],
+    );
+  },
+  data: (message) => {
+    const nodes = [el("p", {}, `Rendered subject: ${message.subject}`)];
+    const substitutions = Object.entries(message.substitutions || {});
+    if (substitutions.length > 0) {
+      nodes.push(table(substitutions, ["Substitution", "Value"]));
+    }
+    if (message.dynamic_template_data) {
+      nodes.push(el("pre", {}, JSON.stringify(message.dynamic_template_data, null, 2)));
+    }
+    const left = unreplaced(message);
+    nodes.push(el("p", {}, left.length ? `Not replaced: ${left.join(", ")}` : "Every tag was replaced"));
+    return el("div", {}, ...nodes);
+  },
+  request: async (message) => {
+    const response = await fetch(`${api}/${encodeURIComponent(message.id)}/request`);
+    if (!response.ok) {
+      return el("p", {}, "The message was not sent by /v3/mail/send");
+    }
+    return el("pre", {}, JSON.stringify(await response.json(), null, 2));
+  },
+  events: async (message) => {
+    const events = await fetchJSON(`${api}/${encodeURIComponent(message.id)}/events`);
+    return table(
+      events.map((e) => [new Date(e.timestamp * 1000).toLocaleString(), e.event, e.email, JSON.stringify(e)]),
+      ["Time", "Event", "Email", "Payload"],
+    );
+  },
+};
+
+async function renderTab() {
+  for (const button of document.querySelectorAll("#tabs button")) {
+    button.classList.toggle("selected", button.dataset.tab === tab);
+  }
+  const content = document.getElementById("content");
+  const message = selected;
+  try {
+    const node = await tabs[tab](message);
+    if (message === selected) {
+      content.replaceChildren(node);
+    }
+  } catch (error) {
+    content.replaceChildren(el("p", {}, error.message));
+  }
+}
+
+for (const button of document.querySelectorAll("#tabs button")) {
+  button.addEventListener("click", () => {
+    tab = button.dataset.tab;
+    renderTab();
+  });
+}
+
+document.getElementById("search").addEventListener("input", () => loadMessages());
+
+document.getElementById("delete-all").addEventListener("click", async () => {
+  await fetch(api, { method: "DELETE" });
+  selected = null;
+  document.getElementById("message").hidden = true;
+  loadMessages();
+});
+
+// Live updates
+const events = new EventSource(`${api}/stream?type=message`);
+events.addEventListener("message", () => loadMessages());
+events.addEventListener("error", () => {
+  document.getElementById("status").textContent = "Reconnecting...";
+});
+events.addEventListener("open", () => loadMessages());
+loadMessages().catch((error) => {
+  document.getElementById("status").textContent = error.message;
+});
@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+//go:embed static
+var static embed.FS
+
+// Serve the inbox web UI under prefix (e.g. "/dev/ui/")
+func GetUI(prefix string) echo.HandlerFunc {
+	files, _ := fs.Sub(static, "static")
+	return echo.WrapHandler(http.StripPrefix(prefix, http.FileServer(http.FS(files))))
+}
+
+// Redirect to the web UI
+func GetIndex(path string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		return c.Redirect(http.StatusFound, path)
+	}
+}
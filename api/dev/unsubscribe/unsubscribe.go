@@ -0,0 +1,148 @@
+package unsubscribe
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Email Preferences</title></head>
+<body>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Groups}}
+<form method="post" action="/dev/asm/preferences">
+<input type="hidden" name="token" value="{{.Token}}">
+<p>{{.Email}}</p>
+{{range .Groups}}<p><label><input type="checkbox" name="group" value="{{.ID}}"{{if .Subscribed}} checked{{end}}> {{.Name}}</label><br><small>{{.Description}}</small></p>
+{{end}}
+<p><label><input type="checkbox" name="global"> Unsubscribe from all emails</label></p>
+<p><button type="submit">Save</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type pageData struct {
+	Message string
+	Token   string
+	Email   string
+	Groups  []pageGroup
+}
+
+type pageGroup struct {
+	asm.Group
+	Subscribed bool
+}
+
+// Record the unsubscribe of <%asm_group_unsubscribe_raw_url%> or <%asm_global_unsubscribe_raw_url%>
+func GetUnsubscribe() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		token, err := asm.ParseToken(c.QueryParam("token"), instance.From(c).TokenKey())
+		if err != nil || token.Email == "" {
+			return render(c, http.StatusBadRequest, pageData{Message: "Invalid link."})
+		}
+
+		if token.GroupID == 0 {
+			instance.From(c).Suppressions.For(token.Subuser).Add(suppression.Unsubscribes, suppression.Suppression{Email: token.Email})
+			publish(c, token, "unsubscribe", nil)
+			return render(c, http.StatusOK, pageData{Message: token.Email + " has been unsubscribed from all emails."})
+		}
+
+		group, ok := instance.From(c).Groups.For(token.Subuser).Get(token.GroupID)
+		if !ok {
+			return render(c, http.StatusNotFound, pageData{Message: "Group not found."})
+		}
+		instance.From(c).Groups.For(token.Subuser).AddSuppressions(group.ID, []string{token.Email})
+		publish(c, token, "group_unsubscribe", map[string]interface{}{"asm_group_id": group.ID})
+		return render(c, http.StatusOK, pageData{Message: token.Email + " has been unsubscribed from " + group.Name + "."})
+	}
+}
+
+// Preferences page of <%asm_preferences_raw_url%>
+func GetPreferences() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		token, err := asm.ParseToken(c.QueryParam("token"), instance.From(c).TokenKey())
+		if err != nil || token.Email == "" {
+			return render(c, http.StatusBadRequest, pageData{Message: "Invalid link."})
+		}
+		return render(c, http.StatusOK, preferences(c, token, c.QueryParam("token"), ""))
+	}
+}
+
+// Save the preferences. Checked groups are subscribed.
+func PostPreferences() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		token, err := asm.ParseToken(c.FormValue("token"), instance.From(c).TokenKey())
+		if err != nil || token.Email == "" {
+			return render(c, http.StatusBadRequest, pageData{Message: "Invalid link."})
+		}
+
+		form, _ := c.FormParams()
+		checked := map[int]bool{}
+		for _, value := range form["group"] {
+			id, _ := strconv.Atoi(value)
+			checked[id] = true
+		}
+
+		for _, id := range groupIDs(token) {
+			subscribed := !instance.From(c).Groups.For(token.Subuser).IsSuppressed(id, token.Email)
+			switch {
+			case checked[id] && !subscribed:
+				instance.From(c).Groups.For(token.Subuser).DeleteSuppression(id, token.Email)
+				publish(c, token, "group_resubscribe", map[string]interface{}{"asm_group_id": id})
+			case !checked[id] && subscribed:
+				if instance.From(c).Groups.For(token.Subuser).AddSuppressions(id, []string{token.Email}) {
+					publish(c, token, "group_unsubscribe", map[string]interface{}{"asm_group_id": id})
+				}
+			}
+		}
+		if c.FormValue("global") != "" {
+			instance.From(c).Suppressions.For(token.Subuser).Add(suppression.Unsubscribes, suppression.Suppression{Email: token.Email})
+			publish(c, token, "unsubscribe", nil)
+		}
+
+		return render(c, http.StatusOK, preferences(c, token, c.FormValue("token"), "Your preferences have been saved."))
+	}
+}
+
+func preferences(c echo.Context, token asm.Token, encoded string, message string) pageData {
+	data := pageData{Message: message, Token: encoded, Email: token.Email}
+	for _, id := range groupIDs(token) {
+		if group, ok := instance.From(c).Groups.For(token.Subuser).Get(id); ok {
+			data.Groups = append(data.Groups, pageGroup{group, !instance.From(c).Groups.For(token.Subuser).IsSuppressed(id, token.Email)})
+		}
+	}
+	return data
+}
+
+// groups_to_display, or group_id without groups_to_display
+func groupIDs(token asm.Token) []int {
+	if len(token.Groups) > 0 {
+		return token.Groups
+	}
+	return []int{token.GroupID}
+}
+
+func publish(c echo.Context, token asm.Token, eventType string, fields map[string]interface{}) {
+	if message, ok := instance.From(c).Messages.Get(token.MessageID); ok {
+		instance.From(c).Dispatcher.Publish(webhook.NewEvent(eventType, message, token.Email, fields))
+	}
+}
+
+func render(c echo.Context, statusCode int, data pageData) error {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		return err
+	}
+	return c.HTMLBlob(statusCode, buf.Bytes())
+}
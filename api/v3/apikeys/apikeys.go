@@ -0,0 +1,152 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/apikeys"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type apiKeyRequest struct {
+	Name   *string  `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// The secret is only returned on create
+type createResponse struct {
+	APIKey   string   `json:"api_key"`
+	APIKeyID string   `json:"api_key_id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+}
+
+type listItem struct {
+	APIKeyID string   `json:"api_key_id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+type listResponse struct {
+	Result []listItem `json:"result"`
+}
+
+func PostAPIKey() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		request, statusCode, errorResponse, ok := decodeRequest(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		key := instance.From(c).APIKeys.Create(*request.Name, request.Scopes)
+		return c.JSON(http.StatusCreated, createResponse{APIKey: key.Key, APIKeyID: key.ID, Name: key.Name, Scopes: key.Scopes})
+	}
+}
+
+// List API keys without scopes like SendGrid
+func GetAPIKeys() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		response := listResponse{Result: []listItem{}}
+		for _, key := range instance.From(c).APIKeys.List() {
+			response.Result = append(response.Result, listItem{APIKeyID: key.ID, Name: key.Name})
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+func GetAPIKey() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		key, ok := instance.From(c).APIKeys.Get(c.Param("api_key_id"))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("unable to find API Key", nil, nil))
+		}
+		return c.JSON(http.StatusOK, listResponse{Result: []listItem{{APIKeyID: key.ID, Name: key.Name, Scopes: key.Scopes}}})
+	}
+}
+
+// Update name and scopes
+func PutAPIKey() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		request, statusCode, errorResponse, ok := decodeRequest(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		scopes := request.Scopes
+		if scopes == nil {
+			scopes = apikeys.Scopes
+		}
+
+		key, ok := instance.From(c).APIKeys.Update(c.Param("api_key_id"), *request.Name, scopes)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("unable to find API Key", nil, nil))
+		}
+		return c.JSON(http.StatusOK, key)
+	}
+}
+
+// Update name
+func PatchAPIKey() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		request, statusCode, errorResponse, ok := decodeRequest(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		key, ok := instance.From(c).APIKeys.Update(c.Param("api_key_id"), *request.Name, nil)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("unable to find API Key", nil, nil))
+		}
+		return c.JSON(http.StatusOK, listItem{APIKeyID: key.ID, Name: key.Name})
+	}
+}
+
+func DeleteAPIKey() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "api_keys.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if !instance.From(c).APIKeys.Delete(c.Param("api_key_id")) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("unable to find API Key", nil, nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Decode request with the required name and valid scopes
+func decodeRequest(c echo.Context) (apiKeyRequest, int, model.ErrorResponse, bool) {
+	var request apiKeyRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return request, http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil), false
+	}
+	if request.Name == nil || *request.Name == "" {
+		return request, http.StatusBadRequest, model.GetErrorResponse("expected name to be a string", "name", nil), false
+	}
+	if scope, ok := apikeys.InvalidScope(request.Scopes); !ok {
+		return request, http.StatusBadRequest, model.GetErrorResponse("invalid scope: "+scope, "scopes", nil), false
+	}
+	return request, http.StatusOK, model.ErrorResponse{}, true
+}
@@ -0,0 +1,181 @@
+package asm
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type groupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsDefault   *bool   `json:"is_default"`
+}
+
+func PostGroup() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request groupRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Name == nil || *request.Name == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("name is required", "name", nil))
+		}
+		if request.Description == nil || *request.Description == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("description is required", "description", nil))
+		}
+		if statusCode, errorResponse, ok := validateGroup(request); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		group := asm.Group{Name: *request.Name, Description: *request.Description}
+		if request.IsDefault != nil {
+			group.IsDefault = *request.IsDefault
+		}
+		return c.JSON(http.StatusCreated, instance.From(c).Groups.For(auth.Subuser(c)).Create(group))
+	}
+}
+
+func GetGroups() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return c.JSON(http.StatusOK, instance.From(c).Groups.For(auth.Subuser(c)).List())
+	}
+}
+
+func GetGroup() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		group, ok := instance.From(c).Groups.For(auth.Subuser(c)).Get(groupID(c))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Group not found", "group_id", nil))
+		}
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+// SendGrid responds 201 to PATCH
+func PatchGroup() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request groupRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if statusCode, errorResponse, ok := validateGroup(request); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		group, ok := instance.From(c).Groups.For(auth.Subuser(c)).Update(groupID(c), func(group *asm.Group) {
+			if request.Name != nil {
+				group.Name = *request.Name
+			}
+			if request.Description != nil {
+				group.Description = *request.Description
+			}
+			if request.IsDefault != nil {
+				group.IsDefault = *request.IsDefault
+			}
+		})
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Group not found", "group_id", nil))
+		}
+		return c.JSON(http.StatusCreated, group)
+	}
+}
+
+func DeleteGroup() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if !instance.From(c).Groups.For(auth.Subuser(c)).Delete(groupID(c)) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Group not found", "group_id", nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func PostGroupSuppressions() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.suppressions.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request globalSuppressionsRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if len(request.RecipientEmails) == 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("recipient_emails is required", "recipient_emails", nil))
+		}
+
+		if !instance.From(c).Groups.For(auth.Subuser(c)).AddSuppressions(groupID(c), request.RecipientEmails) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Group not found", "group_id", nil))
+		}
+		return c.JSON(http.StatusCreated, request)
+	}
+}
+
+func GetGroupSuppressions() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.suppressions.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		emails, ok := instance.From(c).Groups.For(auth.Subuser(c)).Suppressions(groupID(c))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Group not found", "group_id", nil))
+		}
+		return c.JSON(http.StatusOK, emails)
+	}
+}
+
+func DeleteGroupSuppression() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.groups.suppressions.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if !instance.From(c).Groups.For(auth.Subuser(c)).DeleteSuppression(groupID(c), c.Param("email")) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Email does not exist", "email", nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Name is up to 30 characters and description is up to 100 characters
+func validateGroup(request groupRequest) (int, model.ErrorResponse, bool) {
+	if request.Name != nil && len(*request.Name) > 30 {
+		return http.StatusBadRequest, model.GetErrorResponse("name must be 30 characters or less", "name", nil), false
+	}
+	if request.Description != nil && len(*request.Description) > 100 {
+		return http.StatusBadRequest, model.GetErrorResponse("description must be 100 characters or less", "description", nil), false
+	}
+	return 0, model.ErrorResponse{}, true
+}
+
+// Invalid group_id is 0, which is never a group
+func groupID(c echo.Context) int {
+	id, _ := strconv.Atoi(c.Param("group_id"))
+	return id
+}
@@ -0,0 +1,67 @@
+package asm
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+)
+
+type globalSuppressionsRequest struct {
+	RecipientEmails []string `json:"recipient_emails"`
+}
+
+type globalSuppressionResponse struct {
+	RecipientEmail string `json:"recipient_email,omitempty"`
+}
+
+func PostGlobalSuppressions() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.suppressions.global.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request globalSuppressionsRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if len(request.RecipientEmails) == 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("recipient_emails is required", "recipient_emails", nil))
+		}
+
+		for _, email := range request.RecipientEmails {
+			instance.From(c).Suppressions.For(auth.Subuser(c)).Add(suppression.Unsubscribes, suppression.Suppression{Email: email})
+		}
+		return c.JSON(http.StatusCreated, request)
+	}
+}
+
+// Response is {} when the email is not suppressed
+func GetGlobalSuppression() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.suppressions.global.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var response globalSuppressionResponse
+		if s, ok := instance.From(c).Suppressions.For(auth.Subuser(c)).Get(suppression.Unsubscribes, c.Param("email")); ok {
+			response.RecipientEmail = s.Email
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+func DeleteGlobalSuppression() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "asm.suppressions.global.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		instance.From(c).Suppressions.For(auth.Subuser(c)).Delete(suppression.Unsubscribes, c.Param("email"))
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,35 @@
+package batch
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type batchResponse struct {
+	BatchID string `json:"batch_id"`
+}
+
+func PostBatch() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "mail.batch.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return c.JSON(http.StatusCreated, batchResponse{BatchID: instance.From(c).Scheduler.CreateBatch()})
+	}
+}
+
+func GetBatch() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "mail.batch.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		if !instance.From(c).Scheduler.HasBatch(c.Param("batch_id")) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("invalid batch id", "batch_id", nil))
+		}
+		return c.JSON(http.StatusOK, batchResponse{BatchID: c.Param("batch_id")})
+	}
+}
@@ -2,9 +2,10 @@ package send
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
 	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
 )
 
@@ -24,9 +25,8 @@ func GetSend() echo.HandlerFunc {
 
 func PostSend() echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
-		Authorization := c.Request().Header["Authorization"]
-		if len(Authorization) == 0 || Authorization[0] != "Bearer "+os.Getenv("SENDGRID_DEV_API_KEY") {
-			return c.JSON(http.StatusUnsupportedMediaType, model.GetErrorResponse("The provided authorization grant is invalid, expired, or revoked", nil, nil))
+		if statusCode, errorResponse, ok := auth.Authorize(c, "mail.send"); !ok {
+			return c.JSON(statusCode, errorResponse)
 		}
 
 		contentType := c.Request().Header["Content-Type"]
@@ -39,11 +39,19 @@ func PostSend() echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
 		}
 
+		postRequest.Subuser = auth.Subuser(c)
+		postRequest.Instance = instance.From(c)
+
 		statusCode, errorResponse := postRequest.Validate()
+		if statusCode == http.StatusOK {
+			// Sandbox mode
+			return c.NoContent(http.StatusOK)
+		}
 		if statusCode != http.StatusAccepted {
 			return c.JSON(statusCode, errorResponse)
 		}
 
+		c.Response().Header().Set("X-Message-Id", postRequest.XMessageId)
 		return c.String(http.StatusAccepted, "")
 	}
 }
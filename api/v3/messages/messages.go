@@ -0,0 +1,63 @@
+package messages
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/activity"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 1000
+)
+
+type getMessagesResponse struct {
+	Messages []activity.Message `json:"messages"`
+}
+
+// List messages of the Email Activity Feed. query filters them in the SendGrid query language.
+func GetMessages() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "messages.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		limit := defaultLimit
+		if c.QueryParam("limit") != "" {
+			limit, err = strconv.Atoi(c.QueryParam("limit"))
+			if err != nil || limit < 1 || limit > maxLimit {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse("limit must be between 1 and 1000", "limit", nil))
+			}
+		}
+
+		var query *activity.Query
+		if c.QueryParam("query") != "" {
+			query, err = activity.ParseQuery(c.QueryParam("query"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse(err.Error(), "query", nil))
+			}
+		}
+
+		messages := instance.From(c).Activity.List(auth.Subuser(c), query, limit)
+		return c.JSON(http.StatusOK, getMessagesResponse{Messages: messages})
+	}
+}
+
+func GetMessage() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "messages.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		message, ok := instance.From(c).Activity.Get(auth.Subuser(c), c.Param("msg_id"))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Message not found", "msg_id", nil))
+		}
+		return c.JSON(http.StatusOK, message)
+	}
+}
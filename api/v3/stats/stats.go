@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/stats"
+)
+
+const (
+	maxNames        = 10
+	defaultSumLimit = 5
+)
+
+func GetStats() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "stats.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		period, statusCode, errorResponse, ok := getPeriod(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return c.JSON(http.StatusOK, stats.Aggregate(instance.From(c).Activity.Events(auth.Subuser(c)), period, stats.Global()))
+	}
+}
+
+// Stats of categories, which are required
+func GetCategoryStats() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "categories.stats.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		period, statusCode, errorResponse, ok := getPeriod(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		categories := c.QueryParams()["categories"]
+		if len(categories) == 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("missing required argument", "categories", nil))
+		}
+		if len(categories) > maxNames {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("too many categories", "categories", nil))
+		}
+		return c.JSON(http.StatusOK, stats.Aggregate(instance.From(c).Activity.Events(auth.Subuser(c)), period, stats.Categories(categories)))
+	}
+}
+
+// Sums of all categories sorted by sort_by_metric
+func GetCategoryStatsSums() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "categories.stats.sums.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		period, statusCode, errorResponse, ok := getPeriod(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		metric := c.QueryParam("sort_by_metric")
+		if metric == "" {
+			metric = "delivered"
+		}
+		if !contains(stats.GlobalMetrics, metric) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("sort_by_metric is invalid", "sort_by_metric", nil))
+		}
+		direction := strings.ToLower(c.QueryParam("sort_by_direction"))
+		if direction != "" && direction != "asc" && direction != "desc" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("sort_by_direction must be one of [asc, desc]", "sort_by_direction", nil))
+		}
+		limit, ok := getInt(c, "limit", defaultSumLimit)
+		if !ok || limit < 1 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("limit is invalid", "limit", nil))
+		}
+		offset, ok := getInt(c, "offset", 0)
+		if !ok || offset < 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("offset is invalid", "offset", nil))
+		}
+
+		sums := stats.Sum(instance.From(c).Activity.Events(auth.Subuser(c)), period, stats.Categories(nil))
+		stats.SortBy(sums.Stats, metric, direction != "asc")
+		if offset > len(sums.Stats) {
+			offset = len(sums.Stats)
+		}
+		sums.Stats = sums.Stats[offset:]
+		if limit < len(sums.Stats) {
+			sums.Stats = sums.Stats[:limit]
+		}
+		return c.JSON(http.StatusOK, sums)
+	}
+}
+
+// Stats of mailbox providers, all found ones when mailbox_providers is not specified
+func GetMailboxProviderStats() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "mailbox_providers.stats.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		period, statusCode, errorResponse, ok := getPeriod(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		providers := c.QueryParams()["mailbox_providers"]
+		if len(providers) > maxNames {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("too many mailbox providers", "mailbox_providers", nil))
+		}
+		return c.JSON(http.StatusOK, stats.Aggregate(instance.From(c).Activity.Events(auth.Subuser(c)), period, stats.MailboxProviders(providers)))
+	}
+}
+
+// Stats of countries, all found ones when country is not specified
+func GetGeoStats() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "geo.stats.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		period, statusCode, errorResponse, ok := getPeriod(c)
+		if !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		var countries []string
+		if country := c.QueryParam("country"); country != "" {
+			countries = []string{strings.ToUpper(country)}
+		}
+		return c.JSON(http.StatusOK, stats.Aggregate(instance.From(c).Activity.Events(auth.Subuser(c)), period, stats.Countries(countries)))
+	}
+}
+
+func getPeriod(c echo.Context) (stats.Period, int, model.ErrorResponse, bool) {
+	if c.QueryParam("start_date") == "" {
+		return stats.Period{}, http.StatusBadRequest, model.GetErrorResponse("missing required argument", "start_date", nil), false
+	}
+	period, err := stats.ParsePeriod(c.QueryParam("start_date"), c.QueryParam("end_date"), c.QueryParam("aggregated_by"))
+	switch err {
+	case nil:
+		return period, http.StatusOK, model.ErrorResponse{}, true
+	case stats.ErrStartDate:
+		return period, http.StatusBadRequest, model.GetErrorResponse(err.Error(), "start_date", nil), false
+	case stats.ErrEndDate:
+		return period, http.StatusBadRequest, model.GetErrorResponse(err.Error(), "end_date", nil), false
+	default:
+		return period, http.StatusBadRequest, model.GetErrorResponse(err.Error(), "aggregated_by", nil), false
+	}
+}
+
+func getInt(c echo.Context, name string, defaultValue int) (int, bool) {
+	if c.QueryParam(name) == "" {
+		return defaultValue, true
+	}
+	n, err := strconv.Atoi(c.QueryParam(name))
+	return n, err == nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package subusers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type postSubuserRequest struct {
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Ips      []string `json:"ips"`
+}
+
+type patchSubuserRequest struct {
+	Disabled *bool `json:"disabled"`
+}
+
+type postSubuserResponse struct {
+	Username         string `json:"username"`
+	UserID           int    `json:"user_id"`
+	Email            string `json:"email"`
+	CreditAllocation struct {
+		Type string `json:"type"`
+	} `json:"credit_allocation"`
+}
+
+func PostSubuser() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "subusers.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request postSubuserRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Username == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("username is required", "username", nil))
+		}
+		if !model.IsValidEmail(request.Email) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("email is invalid", "email", nil))
+		}
+		if request.Password == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("password is required", "password", nil))
+		}
+
+		subuser, ok := instance.From(c).Subusers.Create(request.Username, request.Email)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("username exists", "username", nil))
+		}
+
+		response := postSubuserResponse{Username: subuser.Username, UserID: subuser.ID, Email: subuser.Email}
+		response.CreditAllocation.Type = "unlimited"
+		return c.JSON(http.StatusCreated, response)
+	}
+}
+
+// List subusers. username filters by prefix.
+func GetSubusers() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "subusers.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return c.JSON(http.StatusOK, instance.From(c).Subusers.List(c.QueryParam("username")))
+	}
+}
+
+func GetSubuser() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "subusers.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		subuser, ok := instance.From(c).Subusers.Get(c.Param("subuser_name"))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("subuser not found", "subuser_name", nil))
+		}
+		return c.JSON(http.StatusOK, subuser)
+	}
+}
+
+// Enable or disable subuser
+func PatchSubuser() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "subusers.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request patchSubuserRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Disabled == nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("disabled is required", "disabled", nil))
+		}
+
+		if !instance.From(c).Subusers.SetDisabled(c.Param("subuser_name"), *request.Disabled) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("subuser not found", "subuser_name", nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Delete subuser with its suppressions, unsubscribe groups and templates
+func DeleteSubuser() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "subusers.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		subuser, ok := instance.From(c).Subusers.Get(c.Param("subuser_name"))
+		if !ok || !instance.From(c).Subusers.Delete(subuser.Username) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("subuser not found", "subuser_name", nil))
+		}
+		instance.From(c).Suppressions.DeleteFor(subuser.Username)
+		instance.From(c).Groups.DeleteFor(subuser.Username)
+		instance.From(c).Templates.DeleteFor(subuser.Username)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
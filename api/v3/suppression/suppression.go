@@ -0,0 +1,124 @@
+package suppression
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+)
+
+type deleteSuppressionsRequest struct {
+	DeleteAll bool     `json:"delete_all"`
+	Emails    []string `json:"emails"`
+}
+
+func GetSuppressions(list string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "suppression."+list+".read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var filter suppression.Filter
+		for key, value := range map[string]*int64{"start_time": &filter.StartTime, "end_time": &filter.EndTime} {
+			if c.QueryParam(key) == "" {
+				continue
+			}
+			if *value, err = strconv.ParseInt(c.QueryParam(key), 10, 64); err != nil {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse(key+" must be an integer", key, nil))
+			}
+		}
+		for key, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+			if c.QueryParam(key) == "" {
+				continue
+			}
+			if *value, err = strconv.Atoi(c.QueryParam(key)); err != nil {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse(key+" must be an integer", key, nil))
+			}
+		}
+
+		return c.JSON(http.StatusOK, instance.From(c).Suppressions.For(auth.Subuser(c)).List(list, filter))
+	}
+}
+
+// Add suppressions, e.g. [{"email": "to@example.com", "reason": "550 unknown"}]
+func PostSuppressions(list string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "suppression."+list+".create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request []suppression.Suppression
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+
+		created := []suppression.Suppression{}
+		for i, s := range request {
+			if s.Email == "" {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse("email is required", strconv.Itoa(i)+".email", nil))
+			}
+		}
+		for _, s := range request {
+			created = append(created, instance.From(c).Suppressions.For(auth.Subuser(c)).Add(list, s))
+		}
+
+		return c.JSON(http.StatusCreated, created)
+	}
+}
+
+func GetSuppression(list string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "suppression."+list+".read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		suppressions := []suppression.Suppression{}
+		if s, ok := instance.From(c).Suppressions.For(auth.Subuser(c)).Get(list, c.Param("email")); ok {
+			suppressions = append(suppressions, s)
+		}
+		return c.JSON(http.StatusOK, suppressions)
+	}
+}
+
+func DeleteSuppression(list string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "suppression."+list+".delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if !instance.From(c).Suppressions.For(auth.Subuser(c)).Delete(list, c.Param("email")) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Email does not exist", "email", nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Delete suppressions with {"delete_all": true} or {"emails": [...]}
+func DeleteSuppressions(list string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "suppression."+list+".delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request deleteSuppressionsRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if !request.DeleteAll && len(request.Emails) == 0 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("delete_all or emails is required", nil, nil))
+		}
+
+		if request.DeleteAll {
+			instance.From(c).Suppressions.For(auth.Subuser(c)).DeleteAll(list)
+		}
+		for _, email := range request.Emails {
+			instance.From(c).Suppressions.For(auth.Subuser(c)).Delete(list, email)
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
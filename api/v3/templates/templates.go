@@ -0,0 +1,300 @@
+package templates
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+)
+
+type postTemplateRequest struct {
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+}
+
+type patchTemplateRequest struct {
+	Name *string `json:"name"`
+}
+
+type patchVersionRequest struct {
+	Active       *int    `json:"active"`
+	Name         *string `json:"name"`
+	HTMLContent  *string `json:"html_content"`
+	PlainContent *string `json:"plain_content"`
+	Subject      *string `json:"subject"`
+	Editor       *string `json:"editor"`
+}
+
+// Response of the paged list (with page_size)
+type listResponse struct {
+	Result   []templates.Template `json:"result"`
+	Metadata struct {
+		Prev  string `json:"prev,omitempty"`
+		Self  string `json:"self"`
+		Next  string `json:"next,omitempty"`
+		Count int    `json:"count"`
+	} `json:"_metadata"`
+}
+
+func PostTemplate() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request postTemplateRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Name == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("name is required", "name", nil))
+		}
+		if request.Generation != "" && request.Generation != templates.GenerationLegacy && request.Generation != templates.GenerationDynamic {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("generation must be one of [legacy, dynamic]", "generation", nil))
+		}
+
+		return c.JSON(http.StatusCreated, instance.From(c).Templates.For(auth.Subuser(c)).Create(request.Name, request.Generation))
+	}
+}
+
+// List templates of generations ("legacy" by default).
+// The response is paged with page_size and page_token, or {"templates": [...]} without page_size like the legacy API.
+func GetTemplates() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		generations := []string{templates.GenerationLegacy}
+		if c.QueryParam("generations") != "" {
+			generations = strings.Split(c.QueryParam("generations"), ",")
+		}
+		for _, generation := range generations {
+			if generation != templates.GenerationLegacy && generation != templates.GenerationDynamic {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse("generations must be a comma separated list of [legacy, dynamic]", "generations", nil))
+			}
+		}
+		list := instance.From(c).Templates.For(auth.Subuser(c)).List(generations)
+
+		if c.QueryParam("page_size") == "" {
+			return c.JSON(http.StatusOK, map[string][]templates.Template{"templates": list})
+		}
+		pageSize, err := strconv.Atoi(c.QueryParam("page_size"))
+		if err != nil || pageSize < 1 || pageSize > 200 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("page_size must be between 1 and 200", "page_size", nil))
+		}
+		// page_token is the offset of the page
+		offset := 0
+		if c.QueryParam("page_token") != "" {
+			if offset, err = strconv.Atoi(c.QueryParam("page_token")); err != nil || offset < 0 {
+				return c.JSON(http.StatusBadRequest, model.GetErrorResponse("page_token is invalid", "page_token", nil))
+			}
+		}
+
+		response := listResponse{Result: []templates.Template{}}
+		response.Metadata.Count = len(list)
+		response.Metadata.Self = pageURL(c, generations, pageSize, offset)
+		if offset > 0 {
+			prev := offset - pageSize
+			if prev < 0 {
+				prev = 0
+			}
+			response.Metadata.Prev = pageURL(c, generations, pageSize, prev)
+		}
+		if offset+pageSize < len(list) {
+			response.Metadata.Next = pageURL(c, generations, pageSize, offset+pageSize)
+		}
+		if offset < len(list) {
+			end := offset + pageSize
+			if end > len(list) {
+				end = len(list)
+			}
+			response.Result = list[offset:end]
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+func GetTemplate() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		template, ok := instance.From(c).Templates.For(auth.Subuser(c)).Get(c.Param("template_id"))
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+
+		return c.JSON(http.StatusOK, template)
+	}
+}
+
+func PatchTemplate() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request patchTemplateRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Name == nil || *request.Name == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("name is required", "name", nil))
+		}
+
+		template, ok := instance.From(c).Templates.For(auth.Subuser(c)).Update(c.Param("template_id"), *request.Name)
+		if !ok {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+		return c.JSON(http.StatusOK, template)
+	}
+}
+
+func DeleteTemplate() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if !instance.From(c).Templates.For(auth.Subuser(c)).Delete(c.Param("template_id")) {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func PostVersion() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.versions.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var version templates.Version
+		if err := json.NewDecoder(c.Request().Body).Decode(&version); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if version.Name == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("name is required", "name", nil))
+		}
+
+		version, err = instance.From(c).Templates.For(auth.Subuser(c)).AddVersion(c.Param("template_id"), version)
+		if err == templates.ErrTemplateNotFound {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse(err.Error(), "html_content", nil))
+		}
+
+		return c.JSON(http.StatusCreated, version)
+	}
+}
+
+func GetVersion() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.versions.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		version, err := instance.From(c).Templates.For(auth.Subuser(c)).GetVersion(c.Param("template_id"), c.Param("version_id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+		return c.JSON(http.StatusOK, version)
+	}
+}
+
+func PatchVersion() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.versions.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request patchVersionRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Name != nil && *request.Name == "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("name is required", "name", nil))
+		}
+		if request.Active != nil && *request.Active != 0 && *request.Active != 1 {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("active must be 0 or 1", "active", nil))
+		}
+
+		version, err := instance.From(c).Templates.For(auth.Subuser(c)).UpdateVersion(c.Param("template_id"), c.Param("version_id"), func(version *templates.Version) {
+			if request.Active != nil {
+				version.Active = *request.Active
+			}
+			if request.Name != nil {
+				version.Name = *request.Name
+			}
+			if request.HTMLContent != nil {
+				version.HTMLContent = *request.HTMLContent
+			}
+			if request.PlainContent != nil {
+				version.PlainContent = *request.PlainContent
+			}
+			if request.Subject != nil {
+				version.Subject = *request.Subject
+			}
+			if request.Editor != nil {
+				version.Editor = *request.Editor
+			}
+		})
+		return versionResponse(c, version, err)
+	}
+}
+
+func DeleteVersion() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.versions.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if err := instance.From(c).Templates.For(auth.Subuser(c)).DeleteVersion(c.Param("template_id"), c.Param("version_id")); err != nil {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Activate version. The other versions of the template are deactivated.
+func PostActivateVersion() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "templates.versions.activate.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		version, err := instance.From(c).Templates.For(auth.Subuser(c)).Activate(c.Param("template_id"), c.Param("version_id"))
+		return versionResponse(c, version, err)
+	}
+}
+
+func versionResponse(c echo.Context, version templates.Version, err error) error {
+	switch err {
+	case nil:
+		return c.JSON(http.StatusOK, version)
+	case templates.ErrTemplateNotFound, templates.ErrVersionNotFound:
+		return c.JSON(http.StatusNotFound, model.GetErrorResponse("Not Found", nil, nil))
+	default:
+		return c.JSON(http.StatusBadRequest, model.GetErrorResponse(err.Error(), "html_content", nil))
+	}
+}
+
+func pageURL(c echo.Context, generations []string, pageSize int, offset int) string {
+	query := url.Values{}
+	query.Set("generations", strings.Join(generations, ","))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	if offset > 0 {
+		query.Set("page_token", strconv.Itoa(offset))
+	}
+	return model.GetPublicURL(instance.From(c).Getenv) + "/v3/templates?" + query.Encode()
+}
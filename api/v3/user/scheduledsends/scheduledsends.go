@@ -0,0 +1,116 @@
+package scheduledsends
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/schedule"
+)
+
+// Status in error messages
+var statusNames = map[string]string{
+	schedule.StatusPause:  "paused",
+	schedule.StatusCancel: "canceled",
+}
+
+type statusRequest struct {
+	BatchID string `json:"batch_id"`
+	Status  string `json:"status"`
+}
+
+// Pause or cancel the scheduled sends of a batch
+func PostScheduledSend() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.scheduled_sends.create"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request statusRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if !isStatus(request.Status) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("status must be one of [pause, cancel]", "status", nil))
+		}
+		status, ok := instance.From(c).Scheduler.Status(request.BatchID)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("invalid batch id", "batch_id", nil))
+		}
+		if status != "" {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("batch id is already "+statusNames[status], "batch_id", nil))
+		}
+
+		instance.From(c).Scheduler.SetStatus(request.BatchID, request.Status)
+		return c.JSON(http.StatusCreated, schedule.Status{BatchID: request.BatchID, Status: request.Status})
+	}
+}
+
+func GetScheduledSends() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.scheduled_sends.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return c.JSON(http.StatusOK, instance.From(c).Scheduler.Statuses())
+	}
+}
+
+// SendGrid responds an array, which is empty when the batch is neither paused nor canceled
+func GetScheduledSend() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.scheduled_sends.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		statuses := []schedule.Status{}
+		if status, _ := instance.From(c).Scheduler.Status(c.Param("batch_id")); status != "" {
+			statuses = append(statuses, schedule.Status{BatchID: c.Param("batch_id"), Status: status})
+		}
+		return c.JSON(http.StatusOK, statuses)
+	}
+}
+
+func PatchScheduledSend() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.scheduled_sends.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request statusRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if !isStatus(request.Status) {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("status must be one of [pause, cancel]", "status", nil))
+		}
+		if status, _ := instance.From(c).Scheduler.Status(c.Param("batch_id")); status == "" {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("batch id not found", "batch_id", nil))
+		}
+
+		instance.From(c).Scheduler.SetStatus(c.Param("batch_id"), request.Status)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// Resume the scheduled sends of a batch. Sends which became due while paused are sent at once.
+func DeleteScheduledSend() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.scheduled_sends.delete"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		if status, _ := instance.From(c).Scheduler.Status(c.Param("batch_id")); status == "" {
+			return c.JSON(http.StatusNotFound, model.GetErrorResponse("batch id not found", "batch_id", nil))
+		}
+
+		instance.From(c).Scheduler.SetStatus(c.Param("batch_id"), "")
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func isStatus(status string) bool {
+	return status == schedule.StatusPause || status == schedule.StatusCancel
+}
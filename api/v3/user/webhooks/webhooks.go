@@ -0,0 +1,60 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+)
+
+type signedResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+type patchSignedRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func GetSigned() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.webhooks.event.settings.read"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+		return signed(c)
+	}
+}
+
+func PatchSigned() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if statusCode, errorResponse, ok := auth.Authorize(c, "user.webhooks.event.settings.update"); !ok {
+			return c.JSON(statusCode, errorResponse)
+		}
+
+		var request patchSignedRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("Bad Request", nil, nil))
+		}
+		if request.Enabled == nil {
+			return c.JSON(http.StatusBadRequest, model.GetErrorResponse("enabled is required", "enabled", nil))
+		}
+		instance.From(c).Dispatcher.Signer().SetEnabled(*request.Enabled)
+
+		return signed(c)
+	}
+}
+
+// The public key is empty while signing is disabled
+func signed(c echo.Context) error {
+	if !instance.From(c).Dispatcher.Signer().Enabled() {
+		return c.JSON(http.StatusOK, signedResponse{})
+	}
+
+	publicKey, err := instance.From(c).Dispatcher.Signer().PublicKey()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, model.GetErrorResponse(err.Error(), nil, nil))
+	}
+	return c.JSON(http.StatusOK, signedResponse{PublicKey: publicKey})
+}
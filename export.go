@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/persist"
+)
+
+// "sendgrid-dev export" writes the messages saved in the data directory as .eml, mbox or Maildir
+func export(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dataDir := flags.String("data", os.Getenv("SENDGRID_DEV_DATA_DIR"), "data directory of the server (SENDGRID_DEV_DATA_DIR)")
+	format := flags.String("format", messages.FormatMbox, "eml, mbox or maildir")
+	output := flags.String("o", "", "output file (eml, mbox) or directory (maildir). Standard output when empty")
+	id := flags.String("id", "", "message ID (required for eml)")
+	filter := messages.Filter{}
+	flags.StringVar(&filter.To, "to", "", "filter by recipient")
+	flags.StringVar(&filter.From, "from", "", "filter by sender")
+	flags.StringVar(&filter.Subject, "subject", "", "filter by subject")
+	flags.StringVar(&filter.Category, "category", "", "filter by category")
+	flags.StringVar(&filter.Subuser, "subuser", "", "filter by subuser")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if *dataDir == "" {
+		return errors.New("-data or SENDGRID_DEV_DATA_DIR is required")
+	}
+
+	if err := (&persist.Persister{Dir: *dataDir}).Load(); err != nil {
+		return err
+	}
+	list := messages.Default.List(filter)
+	if *id != "" {
+		message, ok := messages.Default.Get(*id)
+		if !ok {
+			return fmt.Errorf("message %s not found", *id)
+		}
+		list = []messages.Message{message}
+	}
+
+	switch *format {
+	case messages.FormatEML:
+		if *id == "" {
+			return errors.New("-id is required for eml")
+		}
+		return writeOutput(*output, stdout, func(w io.Writer) error {
+			_, err := w.Write(list[0].EML())
+			return err
+		})
+	case messages.FormatMbox:
+		return writeOutput(*output, stdout, func(w io.Writer) error {
+			return messages.WriteMbox(w, list)
+		})
+	case messages.FormatMaildir:
+		if *output == "" {
+			return errors.New("-o is required for maildir")
+		}
+		return messages.WriteMaildir(*output, list)
+	}
+	return fmt.Errorf("invalid format %q", *format)
+}
+
+func writeOutput(path string, stdout io.Writer, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -3,9 +3,11 @@ module github.com/yKanazawa/sendgrid-dev
 go 1.21.1
 
 require (
+	github.com/aymerick/raymond v2.0.2+incompatible
 	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/steinfletcher/apitest v1.5.15
+	golang.org/x/net v0.21.0
 	gopkg.in/go-playground/validator.v9 v9.31.0
 )
 
@@ -25,7 +27,6 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	golang.org/x/crypto v0.20.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
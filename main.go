@@ -2,12 +2,31 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/yKanazawa/sendgrid-dev/model/dev/persist"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/smtpd"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/apikeys"
+	send "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
 	"github.com/yKanazawa/sendgrid-dev/route"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := export(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if os.Getenv("SENDGRID_DEV_API_SERVER") == "" {
 		os.Setenv("SENDGRID_DEV_API_SERVER", ":3030")
 	}
@@ -21,10 +40,111 @@ func main() {
 	if os.Getenv("SENDGRID_DEV_SMTP_SERVER") == "" {
 		os.Setenv("SENDGRID_DEV_SMTP_SERVER", "127.0.0.1:1025")
 	}
+	fmt.Println("SENDGRID_DEV_PUBLIC_URL", send.GetPublicURL(os.Getenv))
+
 	fmt.Println("SENDGRID_DEV_SMTP_SERVER", os.Getenv("SENDGRID_DEV_SMTP_SERVER"))
 	fmt.Println("SENDGRID_DEV_SMTP_USERNAME", os.Getenv("SENDGRID_DEV_SMTP_USERNAME"))
 	fmt.Println("SENDGRID_DEV_SMTP_PASSWORD", os.Getenv("SENDGRID_DEV_SMTP_PASSWORD"))
 
+	fmt.Println("SENDGRID_DEV_SMTP_LISTEN", os.Getenv("SENDGRID_DEV_SMTP_LISTEN"))
+	if os.Getenv("SENDGRID_DEV_SMTP_LISTEN") != "" {
+		smtpServer := &smtpd.Server{
+			Addr:     os.Getenv("SENDGRID_DEV_SMTP_LISTEN"),
+			Username: os.Getenv("SENDGRID_DEV_SMTP_LISTEN_USERNAME"),
+			Password: os.Getenv("SENDGRID_DEV_SMTP_LISTEN_PASSWORD"),
+		}
+		go func() {
+			log.Fatal(smtpServer.ListenAndServe())
+		}()
+	}
+
+	if os.Getenv("SENDGRID_DEV_TRANSPORT") == "" {
+		os.Setenv("SENDGRID_DEV_TRANSPORT", "smtp")
+	}
+	fmt.Println("SENDGRID_DEV_TRANSPORT", os.Getenv("SENDGRID_DEV_TRANSPORT"))
+	if _, err := send.GetTransport(os.Getenv); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("SENDGRID_DEV_EVENT_WEBHOOK_URL", os.Getenv("SENDGRID_DEV_EVENT_WEBHOOK_URL"))
+	fmt.Println("SENDGRID_DEV_EVENT_WEBHOOK_EVENTS", webhook.Default.EventTypes())
+	fmt.Println("SENDGRID_DEV_EVENT_WEBHOOK_SIGNED", os.Getenv("SENDGRID_DEV_EVENT_WEBHOOK_SIGNED"))
+	webhook.DefaultSigner.SetEnabled(os.Getenv("SENDGRID_DEV_EVENT_WEBHOOK_SIGNED") == "1")
+	if os.Getenv("SENDGRID_DEV_EVENT_WEBHOOK_PRIVATE_KEY") != "" {
+		if err := webhook.DefaultSigner.LoadKey(os.Getenv("SENDGRID_DEV_EVENT_WEBHOOK_PRIVATE_KEY")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println("SENDGRID_DEV_DATA_DIR", os.Getenv("SENDGRID_DEV_DATA_DIR"))
+	if os.Getenv("SENDGRID_DEV_DATA_DIR") != "" {
+		persister, err := newPersister()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := persister.Load(); err != nil {
+			log.Fatal(err)
+		}
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			persister.Run(stop)
+			close(done)
+		}()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+			<-done
+			os.Exit(0)
+		}()
+	}
+
+	fmt.Println("SENDGRID_DEV_TEMPLATE_DIR", os.Getenv("SENDGRID_DEV_TEMPLATE_DIR"))
+	if os.Getenv("SENDGRID_DEV_TEMPLATE_DIR") != "" {
+		if err := templates.Default.LoadDir(os.Getenv("SENDGRID_DEV_TEMPLATE_DIR")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println("SENDGRID_DEV_API_KEYS_FILE", os.Getenv("SENDGRID_DEV_API_KEYS_FILE"))
+	if os.Getenv("SENDGRID_DEV_API_KEYS_FILE") != "" {
+		if err := apikeys.Default.LoadFile(os.Getenv("SENDGRID_DEV_API_KEYS_FILE")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	router := route.Init()
 	router.Logger.Fatal(router.Start(os.Getenv("SENDGRID_DEV_API_SERVER")))
 }
+
+func newPersister() (*persist.Persister, error) {
+	persister := &persist.Persister{Dir: os.Getenv("SENDGRID_DEV_DATA_DIR"), Interval: time.Second}
+	fmt.Println("SENDGRID_DEV_DATA_MAX_MESSAGES", os.Getenv("SENDGRID_DEV_DATA_MAX_MESSAGES"))
+	if value := os.Getenv("SENDGRID_DEV_DATA_MAX_MESSAGES"); value != "" {
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid SENDGRID_DEV_DATA_MAX_MESSAGES %q", value)
+		}
+		persister.MaxMessages = max
+	}
+	fmt.Println("SENDGRID_DEV_DATA_MAX_AGE", os.Getenv("SENDGRID_DEV_DATA_MAX_AGE"))
+	if value := os.Getenv("SENDGRID_DEV_DATA_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid SENDGRID_DEV_DATA_MAX_AGE %q", value)
+		}
+		persister.MaxAge = maxAge
+	}
+	fmt.Println("SENDGRID_DEV_DATA_SAVE_INTERVAL", os.Getenv("SENDGRID_DEV_DATA_SAVE_INTERVAL"))
+	if value := os.Getenv("SENDGRID_DEV_DATA_SAVE_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid SENDGRID_DEV_DATA_SAVE_INTERVAL %q", value)
+		}
+		persister.Interval = interval
+	}
+	return persister, nil
+}
@@ -1,12 +1,51 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/steinfletcher/apitest"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/persist"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/smtpd"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/stream"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/activity"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/apikeys"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/mail"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/schedule"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/stats"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/subusers"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/tracking"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
 	"github.com/yKanazawa/sendgrid-dev/route"
+	"github.com/yKanazawa/sendgrid-dev/sendgriddev"
+	"golang.org/x/net/websocket"
 )
 
 func TestSend(t *testing.T) {
@@ -27,7 +66,7 @@ func TestSend(t *testing.T) {
 		Post("/v3/mail/send").
 		Expect(t).
 		Body(`{"errors":[{"message":"The provided authorization grant is invalid, expired, or revoked","field":null,"help":null}]}`).
-		Status(http.StatusUnsupportedMediaType).
+		Status(http.StatusUnauthorized).
 		End()
 
 	// NG (Missing Content-Type)
@@ -82,6 +121,27 @@ func TestSend(t *testing.T) {
 		Status(http.StatusBadRequest).
 		End()
 
+	// NG (Empty personalizations)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"The personalizations field is required and must have at least one personalization.","field":"personalizations","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#-Personalizations-Errors"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
 	// NG (Missing from.Email)
 	apitest.New().
 		Handler(route.Init()).
@@ -604,3 +664,3143 @@ func TestSend(t *testing.T) {
 		Status(http.StatusAccepted).
 		End()
 }
+
+func TestSendWithTemplate(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (create dynamic template)
+	var template templates.Template
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Template", "generation": "dynamic"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&template)
+
+	// OK (create version)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates/" + template.ID + "/versions").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"name": "Version",
+			"subject": "Hello {{name}}",
+			"html_content": "<h1>Hello {{name}}</h1>{{#each items}}<p>{{this}}</p>{{/each}}",
+			"plain_content": "Hello {{name}}"
+		}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	// NG (invalid Handlebars)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates/" + template.ID + "/versions").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Version", "subject": "{{#if name}}"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (template_id without content and subject)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"dynamic_template_data": {
+					"name": "To",
+					"items": ["a", "b"]
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"template_id": "` + template.ID + `"
+		}`).
+		Expect(t).
+		Body(``).
+		Status(http.StatusAccepted).
+		End()
+
+	// NG (substitutions with dynamic template)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"substitutions": {
+					"-name-": "To"
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"template_id": "` + template.ID + `"
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"Substitutions may not be used with dynamic templating","field":"personalizations.0.substitutions","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.personalizations.substitutions"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (sections with dynamic template)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"sections": {
+				"-section-": "Section"
+			},
+			"template_id": "` + template.ID + `"
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"Substitutions may not be used with dynamic templating","field":"sections","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.sections"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (template of a later personalization fails to render, and nothing is sent)
+	var broken templates.Template
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Broken", "generation": "dynamic"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&broken)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates/" + broken.ID + "/versions").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Version", "subject": "Subject", "html_content": "{{#if broken}}{{#equals broken}}x{{/equals}}{{/if}}"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"dynamic_template_data": {
+					"broken": false
+				}
+			}, {
+				"to": [{
+					"email": "to2@example.com"
+				}],
+				"dynamic_template_data": {
+					"broken": true
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"template_id": "` + broken.ID + `"
+		}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("messages sent before the render error %+v", list)
+	}
+
+	// NG (template_id is not GUID)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"template_id": "invalid"
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"The template_id must be a valid GUID, you provided 'invalid'.","field":"template_id","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.template_id"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (unknown template_id)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"template_id": "d-00000000000000000000000000000000"
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"The template_id is not a valid template ID.","field":"template_id","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.template_id"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestMessages(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (delete all messages)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/dev/messages").
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	for _, to := range []string{"to1@example.com", "to2@example.com"} {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "` + to + `"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject ` + to + `",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}],
+				"categories": ["category"]
+			}`).
+			Expect(t).
+			Status(http.StatusAccepted).
+			End()
+	}
+
+	// OK (list all messages)
+	var list []messages.Message
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&list)
+	if len(list) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(list))
+	}
+
+	// OK (filter by to, subject and category)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages").
+		QueryParams(map[string]string{"to": "to2@example.com", "subject": "subject", "category": "category"}).
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&list)
+	if len(list) != 1 || list[0].To[0].Email != "to2@example.com" || list[0].Subject != "Subject to2@example.com" {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+
+	// OK (get message)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// OK (get raw message)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID + "/raw").
+		Expect(t).
+		Header("Content-Type", "message/rfc822").
+		Status(http.StatusOK).
+		End()
+
+	// OK (delete message)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/dev/messages/" + list[0].ID).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// NG (message not found)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID).
+		Expect(t).
+		Body(`{"errors":[{"message":"Message not found","field":"id","help":null}]}`).
+		Status(http.StatusNotFound).
+		End()
+
+	// OK (filter without match)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages").
+		QueryParams(map[string]string{"from": "nobody@example.com"}).
+		Expect(t).
+		Body(`[]`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (listener calls back into the store)
+	store := messages.NewStore()
+	store.Listen(func(message messages.Message) {
+		store.Get(message.ID)
+	})
+	added := make(chan struct{})
+	go func() {
+		store.Add(messages.Message{Subject: "Listener"})
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener deadlocks the store")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "")
+	os.Setenv("SENDGRID_DEV_TRANSPORT", "file,maildir,noop")
+	os.Setenv("SENDGRID_DEV_FILE_DIR", t.TempDir())
+	os.Setenv("SENDGRID_DEV_MAILDIR", t.TempDir())
+	defer func() {
+		os.Setenv("SENDGRID_DEV_TEST", "1")
+		os.Setenv("SENDGRID_DEV_TRANSPORT", "")
+	}()
+
+	// OK (file and maildir)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Body(``).
+		Status(http.StatusAccepted).
+		End()
+
+	files, _ := filepath.Glob(filepath.Join(os.Getenv("SENDGRID_DEV_FILE_DIR"), "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 eml file, got %d", len(files))
+	}
+	maildirFiles, _ := filepath.Glob(filepath.Join(os.Getenv("SENDGRID_DEV_MAILDIR"), "new", "*"))
+	if len(maildirFiles) != 1 {
+		t.Fatalf("expected 1 maildir file, got %d", len(maildirFiles))
+	}
+
+	// OK (every transport sends the stored MIME message)
+	message, _ := messages.Default.Get(strings.TrimSuffix(filepath.Base(files[0]), ".eml"))
+	for _, file := range []string{files[0], maildirFiles[0]} {
+		if raw, _ := os.ReadFile(file); len(message.Raw) == 0 || !bytes.Equal(raw, message.Raw) {
+			t.Fatalf("%s differs from the stored message", file)
+		}
+	}
+
+	// NG (unknown transport)
+	os.Setenv("SENDGRID_DEV_TRANSPORT", "unknown")
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"unknown transport \"unknown\"","field":null,"help":null}]}`).
+		Status(http.StatusInternalServerError).
+		End()
+}
+
+func TestEventWebhook(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	received := make(chan []map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&events)
+		received <- events
+	}))
+	defer server.Close()
+
+	os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_URL", server.URL)
+	os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_BATCH_INTERVAL", "10ms")
+	defer os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_URL", "")
+
+	// OK (processed and delivered)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/dev/messages").
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/html",
+				"value": "<a href=\"https://example.com/\">Link</a>"
+			}],
+			"categories": ["category"],
+			"custom_args": {
+				"user_id": "1"
+			}
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	events := waitEvents(t, received)
+	list := messages.Default.List(messages.Filter{})
+	if len(events) != 2 || events[0]["event"] != "processed" || events[1]["event"] != "delivered" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events[0]["sg_message_id"] != list[0].ID || events[0]["category"] != "category" || events[0]["user_id"] != "1" {
+		t.Fatalf("unexpected event %+v", events[0])
+	}
+
+	// OK (synthetic click)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/dev/messages/" + list[0].ID + "/events").
+		JSON(`{"event": "click"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	events = waitEvents(t, received)
+	if len(events) != 1 || events[0]["event"] != "click" || events[0]["url"] != "https://example.com/" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// NG (unknown event)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/dev/messages/" + list[0].ID + "/events").
+		JSON(`{"event": "unknown"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"event is invalid","field":"event","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (listener calls back into the dispatcher)
+	dispatcher := webhook.NewDispatcher(&webhook.Signer{}, func(key string) string { return "" })
+	dispatcher.Listen(func(event webhook.Event) {
+		dispatcher.History(event["sg_message_id"].(string))
+	})
+	published := make(chan struct{})
+	go func() {
+		dispatcher.PublishAccepted(list[0])
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener deadlocks the dispatcher")
+	}
+}
+
+func waitEvents(t *testing.T, received chan []map[string]interface{}) []map[string]interface{} {
+	select {
+	case events := <-received:
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("event webhook not received")
+	}
+	return nil
+}
+
+func TestSignedEventWebhook(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (enable signed webhook)
+	var signed struct {
+		PublicKey string `json:"public_key"`
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/user/webhooks/event/settings/signed").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"enabled": true}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&signed)
+	defer webhook.DefaultSigner.SetEnabled(false)
+
+	der, _ := base64.StdEncoding.DecodeString(signed.PublicKey)
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := make(chan bool, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature, _ := base64.StdEncoding.DecodeString(r.Header.Get(webhook.SignatureHeader))
+		hash := sha256.Sum256(append([]byte(r.Header.Get(webhook.TimestampHeader)), body...))
+		verified <- ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hash[:], signature)
+	}))
+	defer server.Close()
+
+	os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_URL", server.URL)
+	os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_BATCH_INTERVAL", "10ms")
+	defer os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_URL", "")
+
+	for _, invalid := range []string{"", "1"} {
+		os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_INVALID_SIGNATURE", invalid)
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "to@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}]
+			}`).
+			Expect(t).
+			Status(http.StatusAccepted).
+			End()
+
+		select {
+		case ok := <-verified:
+			if ok != (invalid == "") {
+				t.Fatalf("unexpected verification result %v (invalid signature %q)", ok, invalid)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("event webhook not received")
+		}
+	}
+	os.Setenv("SENDGRID_DEV_EVENT_WEBHOOK_INVALID_SIGNATURE", "")
+
+	// NG (missing enabled)
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/user/webhooks/event/settings/signed").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"enabled is required","field":"enabled","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestSuppression(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (add bounce)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/suppression/bounces").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`[{"email": "bounce@example.com", "reason": "550 unknown", "status": "5.1.1", "created": 1700000000}]`).
+		Expect(t).
+		Body(`[{"created":1700000000,"email":"bounce@example.com","reason":"550 unknown","status":"5.1.1"}]`).
+		Status(http.StatusCreated).
+		End()
+
+	// OK (get bounce)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/suppression/bounces/bounce@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`[{"created":1700000000,"email":"bounce@example.com","reason":"550 unknown","status":"5.1.1"}]`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (list bounces with start_time)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/suppression/bounces").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		QueryParams(map[string]string{"start_time": "1700000001"}).
+		Expect(t).
+		Body(`[]`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (add global unsubscribe)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/asm/suppressions/global").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"recipient_emails": ["unsubscribe@example.com"]}`).
+		Expect(t).
+		Body(`{"recipient_emails":["unsubscribe@example.com"]}`).
+		Status(http.StatusCreated).
+		End()
+
+	// OK (get global unsubscribe)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/asm/suppressions/global/unsubscribe@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`{"recipient_email":"unsubscribe@example.com"}`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (suppressed recipients are dropped)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "bounce@example.com"
+				}, {
+					"email": "to@example.com"
+				}],
+				"cc": [{
+					"email": "Unsubscribe@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	list := messages.Default.List(messages.Filter{})
+	if len(list) != 1 || len(list[0].To) != 1 || list[0].To[0].Email != "to@example.com" || len(list[0].Cc) != 0 {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+	dropped := map[string]interface{}{}
+	for _, event := range webhook.Default.History(list[0].ID) {
+		if event["event"] == "dropped" {
+			dropped[event["email"].(string)] = event["reason"]
+		}
+	}
+	if dropped["bounce@example.com"] != "Bounced Address" || dropped["Unsubscribe@example.com"] != "Unsubscribed Address" {
+		t.Fatalf("unexpected dropped events %+v", dropped)
+	}
+
+	// OK (delete all bounces)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/suppression/bounces").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"delete_all": true}`).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// OK (delete global unsubscribe)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/asm/suppressions/global/unsubscribe@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// NG (email does not exist)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/suppression/bounces/bounce@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`{"errors":[{"message":"Email does not exist","field":"email","help":null}]}`).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestASM(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (create group)
+	var group asm.Group
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/asm/groups").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Newsletter", "description": "Weekly newsletter"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&group)
+	groupID := strconv.Itoa(group.ID)
+
+	// NG (missing description)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/asm/groups").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Newsletter"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"description is required","field":"description","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	send := func(groupID string) {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "to@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/html",
+					"value": "<a href=\"<%asm_group_unsubscribe_raw_url%>\">Unsubscribe</a> <a href=\"<%asm_preferences_raw_url%>\">Preferences</a>"
+				}],
+				"asm": {
+					"group_id": ` + groupID + `
+				}
+			}`).
+			Expect(t).
+			Status(http.StatusAccepted).
+			End()
+	}
+
+	// OK (unsubscribe URL)
+	messages.Default.DeleteAll()
+	send(groupID)
+	list := messages.Default.List(messages.Filter{})
+	matches := regexp.MustCompile(`href="http://[^/]+/dev/asm/unsubscribe\?token=([^"]+)"`).FindStringSubmatch(list[0].HTML)
+	if len(matches) != 2 || !strings.Contains(list[0].HTML, "/dev/asm/preferences?token=") {
+		t.Fatalf("unexpected html %s", list[0].HTML)
+	}
+
+	// OK (click unsubscribe URL)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/asm/unsubscribe").
+		Query("token", matches[1]).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/asm/groups/" + groupID + "/suppressions").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`["to@example.com"]`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (group unsubscribed recipient is dropped)
+	messages.Default.DeleteAll()
+	send(groupID)
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+
+	// OK (delete group suppression)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/asm/groups/" + groupID + "/suppressions/to@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// NG (unknown group_id)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"asm": {
+				"group_id": 999999
+			}
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"The asm.group_id must be a valid unsubscribe group ID.","field":"asm.group_id","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.asm.group_id"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (delete group)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/asm/groups/" + groupID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+}
+
+func TestMessageID(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (X-Message-Id and sg_message_id per personalization)
+	messages.Default.DeleteAll()
+	result := apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to1@example.com"
+				}]
+			}, {
+				"to": [{
+					"email": "to2@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		HeaderPresent("X-Message-Id").
+		Status(http.StatusAccepted).
+		End()
+
+	xMessageID := result.Response.Header.Get("X-Message-Id")
+	list := messages.Default.List(messages.Filter{})
+	if len(list) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(list))
+	}
+	for _, message := range list {
+		if message.XMessageID != xMessageID || !strings.HasPrefix(message.ID, xMessageID+".") {
+			t.Fatalf("unexpected message ID %s (X-Message-Id %s)", message.ID, xMessageID)
+		}
+		if !strings.Contains(string(message.Raw), "X-Sg-Message-Id: "+message.ID) {
+			t.Fatalf("sg_message_id not in MIME message %s", message.Raw)
+		}
+		for _, event := range webhook.Default.History(message.ID) {
+			if event["sg_message_id"] != message.ID {
+				t.Fatalf("unexpected event %+v", event)
+			}
+		}
+	}
+	if list[0].ID == list[1].ID {
+		t.Fatalf("duplicate message ID %s", list[0].ID)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// NG (multiple errors)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "invalid"
+				}, {
+					"email": "to@example.com"
+				}],
+				"cc": [{
+					"email": "TO@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/html",
+				"value": "<h1>Content</h1>"
+			}, {
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Body(`{"errors":[
+			{"message":"Does not contain a valid address.","field":"personalizations.0.to.0.email","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.personalizations.to"},
+			{"message":"Each email address in the personalization block should be unique between to, cc, and bcc. We found the first duplicate instance of [TO@example.com] in the personalizations.0.cc field.","field":"personalizations.0","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.recipient.duplicates"},
+			{"message":"If present, text/plain and text/html may only be provided in this order: text/plain, text/html, then any other content.","field":"content.1.type","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.content.type"}
+		]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (reply_to and reply_to_list, reserved header, too many categories)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"reply_to": {
+				"email": "reply_to@example.com"
+			},
+			"reply_to_list": [{
+				"email": "reply_to@example.com"
+			}],
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"headers": {
+				"X-SG-ID": "1"
+			},
+			"categories": ["1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"]
+		}`).
+		Expect(t).
+		Body(`{"errors":[
+			{"message":"The reply_to and reply_to_list properties are mutually exclusive. Please use only one of them.","field":"reply_to_list","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.reply_to_list"},
+			{"message":"The following header is reserved and cannot be used: X-SG-ID.","field":"headers","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.headers"},
+			{"message":"You may not have more than 10 categories per request.","field":"categories","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.categories"}
+		]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (missing to, invalid from and inline attachment without content_id)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"subject": "Subject"
+			}],
+			"from": {
+				"email": "from"
+			},
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"attachments": [{
+				"content": "dGVzdA==",
+				"filename": "image.png",
+				"disposition": "inline"
+			}]
+		}`).
+		Expect(t).
+		Body(`{"errors":[
+			{"message":"The to array is required for all personalization objects, and must have at least one email object with a valid email address.","field":"personalizations.0.to","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.personalizations.to"},
+			{"message":"The from email does not contain a valid address.","field":"from.email","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.from"},
+			{"message":"The content_id parameter is required if your attachment disposition is inline.","field":"attachments.0.content_id","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.attachments.content_id"}
+		]}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestHeadersAndCustomArgs(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (headers and custom_args are merged with personalization)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"headers": {
+					"X-Test": "personalization"
+				},
+				"custom_args": {
+					"b": "personalization"
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"headers": {
+				"X-Test": "request",
+				"X-Request": "request"
+			},
+			"custom_args": {
+				"a": "request",
+				"b": "request"
+			},
+			"categories": ["category1", "category2"]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	list := messages.Default.List(messages.Filter{})
+	raw := string(list[0].Raw)
+	for _, header := range []string{
+		"X-Test: personalization\r\n",
+		"X-Request: request\r\n",
+		`X-Smtpapi: {"category":["category1","category2"],"unique_args":{"a":"request","b":"personalization"}}` + "\r\n",
+	} {
+		if !strings.Contains(raw, header) {
+			t.Fatalf("%q not in MIME message %s", header, raw)
+		}
+	}
+
+	events := webhook.Default.History(list[0].ID)
+	if events[0]["a"] != "request" || events[0]["b"] != "personalization" {
+		t.Fatalf("unexpected event %+v", events[0])
+	}
+	if category, _ := events[0]["category"].([]string); len(category) != 2 {
+		t.Fatalf("unexpected event %+v", events[0])
+	}
+}
+
+func TestScheduledSend(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+	defer schedule.Default.Reset()
+
+	// OK (create batch ID)
+	var batch struct {
+		BatchID string `json:"batch_id"`
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/batch").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&batch)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/mail/batch/" + batch.BatchID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`{"batch_id":"` + batch.BatchID + `"}`).
+		Status(http.StatusOK).
+		End()
+
+	send := func(sendAt int64, batchID string) *http.Response {
+		return apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "to@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}],
+				"send_at": ` + strconv.FormatInt(sendAt, 10) + `,
+				"batch_id": "` + batchID + `"
+			}`).
+			Expect(t).
+			End().
+			Response
+	}
+	advance := func(duration string) {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/dev/clock/advance").
+			JSON(`{"duration": "` + duration + `"}`).
+			Expect(t).
+			Status(http.StatusOK).
+			End()
+	}
+
+	// NG (invalid batch ID and send_at too far in the future)
+	if response := send(schedule.Default.Now().Add(73*time.Hour).Unix(), "unknown"); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	// OK (held until send_at)
+	messages.Default.DeleteAll()
+	if response := send(schedule.Default.Now().Add(time.Hour).Unix(), ""); response.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("message sent before send_at %+v", list)
+	}
+	advance("1h")
+	if list := messages.Default.List(messages.Filter{}); len(list) != 1 {
+		t.Fatalf("message not sent at send_at %+v", list)
+	}
+
+	// OK (pause and resume batch)
+	messages.Default.DeleteAll()
+	send(schedule.Default.Now().Add(time.Hour).Unix(), batch.BatchID)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/user/scheduled_sends").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"batch_id": "` + batch.BatchID + `", "status": "pause"}`).
+		Expect(t).
+		Body(`{"batch_id":"` + batch.BatchID + `","status":"pause"}`).
+		Status(http.StatusCreated).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/user/scheduled_sends/" + batch.BatchID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`[{"batch_id":"` + batch.BatchID + `","status":"pause"}]`).
+		Status(http.StatusOK).
+		End()
+	advance("2h")
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("message of paused batch sent %+v", list)
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/user/scheduled_sends/" + batch.BatchID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	if list := messages.Default.List(messages.Filter{}); len(list) != 1 {
+		t.Fatalf("message of resumed batch not sent %+v", list)
+	}
+
+	// OK (cancel batch)
+	messages.Default.DeleteAll()
+	send(schedule.Default.Now().Add(time.Hour).Unix(), batch.BatchID)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/user/scheduled_sends").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"batch_id": "` + batch.BatchID + `", "status": "cancel"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+	advance("1h")
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("message of canceled batch sent %+v", list)
+	}
+	if pending := schedule.Default.Pending(); pending != 0 {
+		t.Fatalf("unexpected pending jobs %d", pending)
+	}
+
+	// OK (sent at send_at after the clock is reset)
+	scheduler := schedule.NewScheduler()
+	scheduler.Advance(2 * time.Second)
+	sent := make(chan struct{})
+	scheduler.Schedule(schedule.Job{SendAt: scheduler.Now().Add(time.Second).Unix(), Send: func() { close(sent) }})
+	scheduler.Reset()
+	select {
+	case <-sent:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("job not sent after reset, pending %d", scheduler.Pending())
+	}
+
+	// NG (already canceled and paused)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/user/scheduled_sends").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"batch_id": "` + batch.BatchID + `", "status": "pause"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"batch id is already canceled","field":"batch_id","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/user/scheduled_sends/" + batch.BatchID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"status": "pause"}`).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/user/scheduled_sends").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"batch_id": "` + batch.BatchID + `", "status": "cancel"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"batch id is already paused","field":"batch_id","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (invalid status)
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/user/scheduled_sends/" + batch.BatchID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"status": "resume"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"status must be one of [pause, cancel]","field":"status","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestMailSettings(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	send := func(mailSettings string) *http.Response {
+		return apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "bounced@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}, {
+					"type": "text/html",
+					"value": "<html><body><p>Content</p></body></html>"
+				}],
+				"mail_settings": ` + mailSettings + `
+			}`).
+			Expect(t).
+			End().
+			Response
+	}
+
+	// OK (sandbox mode)
+	messages.Default.DeleteAll()
+	if response := send(`{"sandbox_mode": {"enable": true}}`); response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+	if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+		t.Fatalf("message delivered in sandbox mode %+v", list)
+	}
+
+	// NG (sandbox mode still validates)
+	if response := send(`{"sandbox_mode": {"enable": true}, "spam_check": {"enable": true, "threshold": 11}}`); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	// NG (bypass_list_management combined with another bypass)
+	if response := send(`{"bypass_list_management": {"enable": true}, "bypass_bounce_management": {"enable": true}}`); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	// OK (footer)
+	messages.Default.DeleteAll()
+	send(`{"footer": {"enable": true, "text": "\nFooter", "html": "<p>Footer</p>"}}`)
+	list := messages.Default.List(messages.Filter{})
+	if list[0].Text != "Content\nFooter" || list[0].HTML != "<html><body><p>Content</p><p>Footer</p></body></html>" {
+		t.Fatalf("unexpected footer %q %q", list[0].Text, list[0].HTML)
+	}
+
+	// OK (bypass management)
+	suppression.Default.Add(suppression.Bounces, suppression.Suppression{Email: "bounced@example.com"})
+	defer suppression.Default.Delete(suppression.Bounces, "bounced@example.com")
+	for _, c := range []struct {
+		mailSettings string
+		count        int
+	}{
+		{`{}`, 0},
+		{`{"bypass_spam_management": {"enable": true}}`, 0},
+		{`{"bypass_bounce_management": {"enable": true}}`, 1},
+		{`{"bypass_list_management": {"enable": true}}`, 1},
+	} {
+		messages.Default.DeleteAll()
+		send(c.mailSettings)
+		if list := messages.Default.List(messages.Filter{}); len(list) != c.count {
+			t.Fatalf("%s: unexpected messages %+v", c.mailSettings, list)
+		}
+	}
+}
+
+func TestTrackingSettings(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (links are tagged and tracked)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Visit https://example.com/page?x=1"
+			}, {
+				"type": "text/html",
+				"value": "<html><body><a href=\"https://example.com/page?x=1&amp;y=2\">Page</a></body></html>"
+			}],
+			"tracking_settings": {
+				"click_tracking": {"enable": true, "enable_text": true},
+				"open_tracking": {"enable": true},
+				"subscription_tracking": {"enable": true, "text": "Unsubscribe: <% %>", "html": "<p><% Unsubscribe %></p>"},
+				"ganalytics": {"enable": true, "utm_source": "sendgrid", "utm_campaign": "spring"}
+			}
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	list := messages.Default.List(messages.Filter{})
+	clicks := regexp.MustCompile(`href="http://[^/]+/dev/track/click\?token=([^"]+)"`).FindStringSubmatch(list[0].HTML)
+	if len(clicks) != 2 {
+		t.Fatalf("link not tracked %s", list[0].HTML)
+	}
+	if !regexp.MustCompile(`<p><a href="http://[^/]+/dev/asm/unsubscribe\?token=[^"]+">Unsubscribe</a></p><img src="http://[^/]+/dev/track/open\?token=([^"]+)"[^>]*/></body></html>$`).MatchString(list[0].HTML) {
+		t.Fatalf("unexpected footer or pixel %s", list[0].HTML)
+	}
+	if !regexp.MustCompile(`^Visit http://[^/]+/dev/track/click\?token=\S+\n\nUnsubscribe: http://[^/]+/dev/asm/unsubscribe\?token=\S+$`).MatchString(list[0].Text) {
+		t.Fatalf("unexpected text %s", list[0].Text)
+	}
+
+	// OK (click redirects to the tagged link)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/track/click").
+		Query("token", clicks[1]).
+		Expect(t).
+		Header("Location", "https://example.com/page?x=1&y=2&utm_source=sendgrid&utm_campaign=spring").
+		Status(http.StatusFound).
+		End()
+
+	// OK (open returns pixel)
+	open := regexp.MustCompile(`/dev/track/open\?token=([^"]+)"`).FindStringSubmatch(list[0].HTML)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/track/open").
+		Query("token", open[1]).
+		Expect(t).
+		Header("Content-Type", "image/gif").
+		Status(http.StatusOK).
+		End()
+
+	events := map[string]webhook.Event{}
+	for _, event := range webhook.Default.History(list[0].ID) {
+		events[event["event"].(string)] = event
+	}
+	if events["click"]["url"] != "https://example.com/page?x=1&y=2&utm_source=sendgrid&utm_campaign=spring" || events["click"]["email"] != "to@example.com" {
+		t.Fatalf("unexpected click event %+v", events["click"])
+	}
+	if _, ok := events["open"]; !ok {
+		t.Fatalf("open event not recorded %+v", events)
+	}
+
+	// NG (invalid click token)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/track/click").
+		Query("token", "invalid").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (click token signed with another key)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/track/click").
+		Query("token", tracking.Token{Email: "to@example.com", MessageID: list[0].ID, URL: "https://evil.example.com/"}.Encode([]byte("other"))).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestSubstitutions(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (sections, nested tags, subject and headers)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"substitutions": {
+					"-name-": "John",
+					"-name_full-": "John Doe",
+					"-greeting-": "%morning%"
+				},
+				"headers": {
+					"X-Name": "-name_full-"
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Hello -name-",
+			"content": [{
+				"type": "text/plain",
+				"value": "-greeting- %footer%"
+			}],
+			"sections": {
+				"%morning%": "Good morning -name_full-.",
+				"%footer%": "Bye -name-."
+			}
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	list := messages.Default.List(messages.Filter{})
+	if list[0].Subject != "Hello John" || list[0].Text != "Good morning John Doe. Bye John." || list[0].Headers["X-Name"] != "John Doe" {
+		t.Fatalf("unexpected substitution %q %q %+v", list[0].Subject, list[0].Text, list[0].Headers)
+	}
+
+	// OK (values which refer to themselves)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"substitutions": {
+					"-x-": "-x--x-"
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "-x-",
+			"content": [{
+				"type": "text/plain",
+				"value": "%loop%"
+			}],
+			"sections": {
+				"%loop%": "%loop%%loop%"
+			}
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	list = messages.Default.List(messages.Filter{})
+	if list[0].Subject != "-x--x-" || list[0].Text != strings.Repeat("%loop%", 4) {
+		t.Fatalf("unexpected substitution %q %q", list[0].Subject, list[0].Text)
+	}
+
+	// NG (substitutions over 10,000 bytes)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"substitutions": {
+					"-name-": "` + strings.Repeat("a", 10000) + `"
+				}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"The substitutions for each personalization must be less than 10000 bytes.","field":"personalizations.0.substitutions","help":"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.personalizations.substitutions"}]}`).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestTemplates(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (create legacy template)
+	var template templates.Template
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Legacy"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&template)
+
+	// OK (rename template)
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/templates/" + template.ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Renamed"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// OK (list by generations)
+	list := func(query string) []templates.Template {
+		var response struct {
+			Templates []templates.Template `json:"templates"`
+			Result    []templates.Template `json:"result"`
+		}
+		apitest.New().
+			Handler(route.Init()).
+			Get("/v3/templates").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			QueryParams(map[string]string{"generations": query, "page_size": "200"}).
+			Expect(t).
+			Status(http.StatusOK).
+			End().
+			JSON(&response)
+		return response.Result
+	}
+	contains := func(list []templates.Template) bool {
+		for _, listed := range list {
+			if listed.ID == template.ID && listed.Name == "Renamed" {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(list("legacy")) || !contains(list("dynamic,legacy")) || contains(list("dynamic")) {
+		t.Fatalf("unexpected list of generations")
+	}
+
+	// NG (invalid generations)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("generations", "static").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (create versions and activate the second)
+	var versions [2]templates.Version
+	for i := range versions {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/templates/" + template.ID + "/versions").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{"name": "Version` + strconv.Itoa(i+1) + `", "subject": "Version` + strconv.Itoa(i+1) + ` <%subject%>", "plain_content": "<%body%>"}`).
+			Expect(t).
+			Status(http.StatusCreated).
+			End().
+			JSON(&versions[i])
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates/" + template.ID + "/versions/" + versions[1].ID + "/activate").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	send := func() string {
+		messages.Default.DeleteAll()
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "to@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}],
+				"template_id": "` + template.ID + `"
+			}`).
+			Expect(t).
+			Status(http.StatusAccepted).
+			End()
+		return messages.Default.List(messages.Filter{})[0].Subject
+	}
+	if subject := send(); subject != "Version2 Subject" {
+		t.Fatalf("active version not used %q", subject)
+	}
+
+	// OK (update version)
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/templates/" + template.ID + "/versions/" + versions[1].ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"subject": "Updated <%subject%>"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if subject := send(); subject != "Updated Subject" {
+		t.Fatalf("updated version not used %q", subject)
+	}
+
+	// OK (delete version)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/templates/" + template.ID + "/versions/" + versions[0].ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates/" + template.ID + "/versions/" + versions[0].ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+
+	// OK (delete template)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/templates/" + template.ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates/" + template.ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestAPIKeys(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (create API key with scopes)
+	var key struct {
+		APIKey   string   `json:"api_key"`
+		APIKeyID string   `json:"api_key_id"`
+		Name     string   `json:"name"`
+		Scopes   []string `json:"scopes"`
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/api_keys").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Mail only", "scopes": ["mail.send"]}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&key)
+	if !strings.HasPrefix(key.APIKey, "SG."+key.APIKeyID+".") || len(key.Scopes) != 1 {
+		t.Fatalf("unexpected key %+v", key)
+	}
+
+	// NG (invalid scope)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/api_keys").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Invalid", "scopes": ["mail.unknown"]}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"invalid scope: mail.unknown","field":"scopes","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (send with the scoped key)
+	send := func(apiKey string) *http.Response {
+		return apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + apiKey}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "to@example.com"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "Content"
+				}]
+			}`).
+			Expect(t).
+			End().
+			Response
+	}
+	if response := send(key.APIKey); response.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	// NG (missing scope)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + key.APIKey}).
+		Expect(t).
+		Body(`{"errors":[{"message":"access forbidden","field":null,"help":null}]}`).
+		Status(http.StatusForbidden).
+		End()
+
+	// OK (update scopes)
+	apitest.New().
+		Handler(route.Init()).
+		Put("/v3/api_keys/" + key.APIKeyID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"name": "Templates", "scopes": ["templates.read"]}`).
+		Expect(t).
+		Body(`{"api_key_id":"` + key.APIKeyID + `","name":"Templates","scopes":["templates.read"]}`).
+		Status(http.StatusOK).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates").
+		Headers(map[string]string{"Authorization": "Bearer " + key.APIKey}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if response := send(key.APIKey); response.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	// OK (get API key)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/api_keys/" + key.APIKeyID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`{"result":[{"api_key_id":"` + key.APIKeyID + `","name":"Templates","scopes":["templates.read"]}]}`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (delete API key)
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/api_keys/" + key.APIKeyID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// NG (deleted key)
+	if response := send(key.APIKey); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+}
+
+func TestSubusers(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (create subuser)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/subusers").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"username": "customer", "email": "customer@example.com", "password": "secret", "ips": ["127.0.0.1"]}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+	defer apitest.New().
+		Handler(route.Init()).
+		Delete("/v3/subusers/customer").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// NG (username exists)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/subusers").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"username": "customer", "email": "customer@example.com", "password": "secret"}`).
+		Expect(t).
+		Body(`{"errors":[{"message":"username exists","field":"username","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	onBehalfOf := map[string]string{
+		"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY"),
+		"On-Behalf-Of":  "customer",
+	}
+
+	// OK (suppressions are isolated)
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/suppression/bounces").
+		Headers(onBehalfOf).
+		JSON(`[{"email": "subuser-bounce@example.com"}]`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/suppression/bounces/subuser-bounce@example.com").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`[]`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (templates are isolated)
+	var template templates.Template
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/templates").
+		Headers(onBehalfOf).
+		JSON(`{"name": "Subuser"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End().
+		JSON(&template)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/templates/" + template.ID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+
+	// OK (send on behalf of subuser)
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(onBehalfOf).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}, {
+					"email": "subuser-bounce@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	var list []messages.Message
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages").
+		Query("subuser", "customer").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&list)
+	if len(list) != 1 || list[0].Subuser != "customer" || len(list[0].To) != 1 {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID).
+		Headers(onBehalfOf).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// NG (messages of another account)
+	other := messages.Default.Add(messages.Message{Subject: "Parent"})
+	for _, path := range []string{"", "/raw", "/eml", "/events"} {
+		apitest.New().
+			Handler(route.Init()).
+			Get("/dev/messages/" + other.ID + path).
+			Headers(onBehalfOf).
+			Expect(t).
+			Status(http.StatusNotFound).
+			End()
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/dev/messages/" + other.ID).
+		Headers(onBehalfOf).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Delete("/dev/messages").
+		Headers(onBehalfOf).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	if _, ok := messages.Default.Get(other.ID); !ok {
+		t.Fatal("message of another account deleted")
+	}
+
+	// NG (unknown subuser)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/suppression/bounces").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY"), "On-Behalf-Of": "unknown"}).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+	for _, path := range []string{"/dev/messages", "/dev/messages/stream", "/dev/messages/" + list[0].ID} {
+		apitest.New().
+			Handler(route.Init()).
+			Get(path).
+			Headers(map[string]string{"On-Behalf-Of": "unknown"}).
+			Expect(t).
+			Status(http.StatusUnauthorized).
+			End()
+		apitest.New().
+			Handler(route.Init()).
+			Get(path).
+			Query("subuser", "unknown").
+			Expect(t).
+			Body(`{"errors":[{"message":"subuser not found","field":"subuser","help":null}]}`).
+			Status(http.StatusNotFound).
+			End()
+	}
+
+	// NG (disabled subuser)
+	apitest.New().
+		Handler(route.Init()).
+		Patch("/v3/subusers/customer").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{"disabled": true}`).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/suppression/bounces").
+		Headers(onBehalfOf).
+		Expect(t).
+		Body(`{"errors":[{"message":"access forbidden","field":null,"help":null}]}`).
+		Status(http.StatusForbidden).
+		End()
+}
+
+func TestActivity(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	activity.Default.DeleteAll()
+	suppression.Default.Add(suppression.Bounces, suppression.Suppression{Email: "activity-bounce@example.com"})
+	defer suppression.Default.Delete(suppression.Bounces, "activity-bounce@example.com")
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}, {
+					"email": "activity-bounce@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Activity",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"categories": ["newsletter", "weekly"]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	// OK (list all)
+	var response struct {
+		Messages []activity.Message `json:"messages"`
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&response)
+	if len(response.Messages) != 2 {
+		t.Fatalf("unexpected messages %+v", response.Messages)
+	}
+
+	// OK (query)
+	for _, c := range []struct {
+		query  string
+		emails []string
+	}{
+		{`to_email="to@example.com"`, []string{"to@example.com"}},
+		{`status="not_delivered"`, []string{"activity-bounce@example.com"}},
+		{`status="delivered" AND Contains(categories,"newsletter")`, []string{"to@example.com"}},
+		{`to_email LIKE "activity-%" OR subject="Other"`, []string{"activity-bounce@example.com"}},
+		{`to_email NOT LIKE "ACTIVITY-%" AND categories LIKE "news%"`, []string{"to@example.com"}},
+		{`to_email NOT IN ("to@example.com")`, []string{"activity-bounce@example.com"}},
+		{`categories != "weekly"`, []string{}},
+		{`categories != "other" AND to_email="to@example.com"`, []string{"to@example.com"}},
+		{`categories NOT IN ("other", "newsletter")`, []string{}},
+		{`last_event_time BETWEEN TIMESTAMP "2000-01-01T00:00:00Z" AND TIMESTAMP "2000-01-02T00:00:00Z"`, []string{}},
+	} {
+		apitest.New().
+			Handler(route.Init()).
+			Get("/v3/messages").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			Query("query", c.query).
+			Expect(t).
+			Status(http.StatusOK).
+			End().
+			JSON(&response)
+		emails := []string{}
+		for _, message := range response.Messages {
+			emails = append(emails, message.ToEmail)
+		}
+		if strings.Join(emails, ",") != strings.Join(c.emails, ",") {
+			t.Fatalf("%s: unexpected messages %+v", c.query, response.Messages)
+		}
+	}
+
+	// OK (get message with events)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("query", `to_email="to@example.com"`).
+		Query("limit", "1").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&response)
+	var detail activity.Detail
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages/" + response.Messages[0].MsgID).
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&detail)
+	if detail.Subject != "Activity" || detail.Status != activity.StatusDelivered || len(detail.Events) != 2 || detail.Events[1].EventName != "delivered" {
+		t.Fatalf("unexpected message %+v", detail)
+	}
+
+	// NG (invalid query)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("query", `to_email=`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (Contains with a field which is not an array)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("query", `Contains(subject,"Activity")`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (invalid limit)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("limit", "1001").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (message not found)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/messages/unknown").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestStats(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	activity.Default.DeleteAll()
+	messages.Default.DeleteAll()
+	suppression.Default.Add(suppression.Bounces, suppression.Suppression{Email: "stats-bounce@example.com"})
+	defer suppression.Default.Delete(suppression.Bounces, "stats-bounce@example.com")
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@gmail.com"
+				}, {
+					"email": "stats-bounce@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}],
+			"categories": ["promo"]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+	list := messages.Default.List(messages.Filter{})
+	for i := 0; i < 2; i++ {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/dev/messages/" + list[0].ID + "/events").
+			JSON(`{"event": "open", "country": "CA"}`).
+			Expect(t).
+			Status(http.StatusOK).
+			End()
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+
+	// OK (global stats by day)
+	var dateStats []stats.DateStats
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", yesterday).
+		Query("end_date", today).
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&dateStats)
+	if len(dateStats) != 2 || dateStats[0].Date != yesterday || dateStats[0].Stats[0].Metrics["requests"] != 0 {
+		t.Fatalf("unexpected stats %+v", dateStats)
+	}
+	metrics := dateStats[1].Stats[0].Metrics
+	if metrics["requests"] != 2 || metrics["processed"] != 1 || metrics["delivered"] != 1 || metrics["bounce_drops"] != 1 || metrics["opens"] != 2 || metrics["unique_opens"] != 1 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+
+	// OK (category stats)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/categories/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", today).
+		Query("categories", "promo").
+		Query("categories", "other").
+		Query("aggregated_by", "month").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&dateStats)
+	if len(dateStats) != 1 || len(dateStats[0].Stats) != 2 || dateStats[0].Stats[0].Name != "promo" || dateStats[0].Stats[0].Type != "category" || dateStats[0].Stats[0].Metrics["delivered"] != 1 || dateStats[0].Stats[1].Metrics["delivered"] != 0 {
+		t.Fatalf("unexpected category stats %+v", dateStats)
+	}
+
+	// OK (category sums)
+	var sums stats.DateStats
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/categories/stats/sums").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", yesterday).
+		Query("sort_by_metric", "opens").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&sums)
+	if sums.Date != yesterday || len(sums.Stats) != 1 || sums.Stats[0].Name != "promo" || sums.Stats[0].Metrics["opens"] != 2 {
+		t.Fatalf("unexpected sums %+v", sums)
+	}
+
+	// OK (mailbox provider and geo stats)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/mailbox_providers/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", today).
+		Query("mailbox_providers", "Gmail").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&dateStats)
+	if dateStats[0].Stats[0].Name != "Gmail" || dateStats[0].Stats[0].Metrics["delivered"] != 1 || dateStats[0].Stats[0].Metrics["drops"] != 0 {
+		t.Fatalf("unexpected mailbox provider stats %+v", dateStats)
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/geo/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", today).
+		Query("country", "ca").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&dateStats)
+	if dateStats[0].Stats[0].Name != "CA" || dateStats[0].Stats[0].Metrics["unique_opens"] != 1 {
+		t.Fatalf("unexpected geo stats %+v", dateStats)
+	}
+
+	// NG (missing start_date)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Expect(t).
+		Body(`{"errors":[{"message":"missing required argument","field":"start_date","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (invalid aggregated_by)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", today).
+		Query("aggregated_by", "year").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// NG (missing categories)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/v3/categories/stats").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		Query("start_date", today).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestSMTPServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &smtpd.Server{Username: "user", Password: "pass"}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// OK (capture message of other SMTP clients)
+	messages.Default.DeleteAll()
+	raw := "From: From <from@example.com>\r\n" +
+		"To: to@example.com\r\n" +
+		"Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n" +
+		"X-SMTPAPI: {\"category\":[\"smtp\"]}\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nContent\r\n" +
+		"--b\r\nContent-Type: text/html\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n<p>Content=3D</p>\r\n" +
+		"--b--\r\n"
+	auth := smtp.PlainAuth("", "user", "pass", "127.0.0.1")
+	if err := smtp.SendMail(listener.Addr().String(), auth, "from@example.com", []string{"to@example.com", "bcc@example.com"}, []byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+	list := messages.Default.List(messages.Filter{})
+	if len(list) != 1 || list[0].Subject != "こんにちは" || list[0].From.Name != "From" || list[0].Text != "Content" || list[0].HTML != "<p>Content=</p>" ||
+		len(list[0].Bcc) != 1 || list[0].Bcc[0].Email != "bcc@example.com" || list[0].Categories[0] != "smtp" {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+
+	// OK (messages sent by the smtp transport are not added twice)
+	messages.Default.DeleteAll()
+	os.Setenv("SENDGRID_DEV_TEST", "")
+	os.Setenv("SENDGRID_DEV_TRANSPORT", "smtp")
+	os.Setenv("SENDGRID_DEV_SMTP_SERVER", listener.Addr().String())
+	os.Setenv("SENDGRID_DEV_SMTP_USERNAME", "user")
+	os.Setenv("SENDGRID_DEV_SMTP_PASSWORD", "pass")
+	defer func() {
+		os.Setenv("SENDGRID_DEV_TEST", "1")
+		os.Setenv("SENDGRID_DEV_TRANSPORT", "")
+		os.Setenv("SENDGRID_DEV_SMTP_SERVER", "")
+		os.Setenv("SENDGRID_DEV_SMTP_USERNAME", "")
+		os.Setenv("SENDGRID_DEV_SMTP_PASSWORD", "")
+	}()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}]
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Subject",
+			"content": [{
+				"type": "text/plain",
+				"value": "Content"
+			}]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+	if list := messages.Default.List(messages.Filter{}); len(list) != 1 || list[0].Subject != "Subject" {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+
+	// NG (invalid credentials)
+	auth = smtp.PlainAuth("", "user", "invalid", "127.0.0.1")
+	if err := smtp.SendMail(listener.Addr().String(), auth, "from@example.com", []string{"to@example.com"}, []byte(raw)); err == nil {
+		t.Fatal("expected authentication error")
+	}
+
+	// OK (capture into the stores of another instance)
+	messages.Default.DeleteAll()
+	activity.Default.DeleteAll()
+	inst := instance.New(func(key string) string { return "" })
+	instanceListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instanceServer := &smtpd.Server{Instance: inst}
+	go instanceServer.Serve(instanceListener)
+	defer instanceServer.Close()
+	if err := smtp.SendMail(instanceListener.Addr().String(), nil, "from@example.com", []string{"to@example.com"}, []byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+	list = inst.Messages.List(messages.Filter{})
+	if len(list) != 1 || len(inst.Activity.List("", nil, 10)) != 1 || len(inst.Dispatcher.History(list[0].ID)) == 0 {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+	if len(messages.Default.List(messages.Filter{})) != 0 || len(activity.Default.List("", nil, 10)) != 0 {
+		t.Fatal("captured into the default stores")
+	}
+
+	// NG (message over the max size, and the session goes on)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	client, err := smtp.NewClient(conn, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Auth(smtp.PlainAuth("", "user", "pass", "127.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Mail("from@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Rcpt("to@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("a", 998) + "\r\n"
+	io.WriteString(writer, "Subject: Large\r\n\r\n")
+	for size := 0; size < 30*1024*1024+200*1024; size += len(line) {
+		if _, err := io.WriteString(writer, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var textErr *textproto.Error
+	if err := writer.Close(); !errors.As(err, &textErr) || textErr.Code != 552 {
+		t.Fatalf("unexpected reply %v", err)
+	}
+	if err := client.Noop(); err != nil {
+		t.Fatalf("session hangs after 552: %v", err)
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+
+	// OK (index redirects to the UI)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/").
+		Expect(t).
+		Header("Location", "/dev/ui/").
+		Status(http.StatusFound).
+		End()
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/ui/").
+		Expect(t).
+		Assert(func(response *http.Response, request *http.Request) error {
+			body, _ := io.ReadAll(response.Body)
+			if !strings.Contains(string(body), "<title>sendgrid-dev</title>") {
+				t.Fatalf("unexpected index %s", body)
+			}
+			return nil
+		}).
+		Status(http.StatusOK).
+		End()
+
+	messages.Default.DeleteAll()
+	apitest.New().
+		Handler(route.Init()).
+		Post("/v3/mail/send").
+		Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+		JSON(`{
+			"personalizations": [{
+				"to": [{
+					"email": "to@example.com"
+				}],
+				"substitutions": {"-name-": "Alice"}
+			}],
+			"from": {
+				"email": "from@example.com"
+			},
+			"subject": "Hello -name-",
+			"content": [{
+				"type": "text/html",
+				"value": "<p>Hello -name-</p>"
+			}],
+			"attachments": [{
+				"content": "dGVzdA==",
+				"type": "text/plain",
+				"filename": "attachment.txt"
+			}]
+		}`).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+	list := messages.Default.List(messages.Filter{})
+	if list[0].Subject != "Hello Alice" || list[0].Substitutions["-name-"] != "Alice" {
+		t.Fatalf("unexpected message %+v", list[0])
+	}
+
+	// OK (sandboxed HTML)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/"+list[0].ID+"/html").
+		Expect(t).
+		Header("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'").
+		Body(`<p>Hello Alice</p>`).
+		Status(http.StatusOK).
+		End()
+
+	// OK (headers)
+	var headers []messages.HeaderField
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID + "/headers").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&headers)
+	found := false
+	for _, header := range headers {
+		found = found || (header.Name == "Subject" && header.Value == "Hello Alice")
+	}
+	if !found {
+		t.Fatalf("unexpected headers %+v", headers)
+	}
+
+	// OK (attachments)
+	var attachments []messages.Attachment
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID + "/attachments").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&attachments)
+	if len(attachments) != 1 || attachments[0].Filename != "attachment.txt" || attachments[0].Size != 4 {
+		t.Fatalf("unexpected attachments %+v", attachments)
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/"+list[0].ID+"/attachments/0").
+		Expect(t).
+		Header("Content-Disposition", "attachment; filename=attachment.txt").
+		Body("test").
+		Status(http.StatusOK).
+		End()
+
+	// OK (original request)
+	var request model.PostRequest
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID + "/request").
+		Expect(t).
+		Status(http.StatusOK).
+		End().
+		JSON(&request)
+	if request.Subject != "Hello -name-" {
+		t.Fatalf("unexpected request %+v", request)
+	}
+
+	// NG (attachment not found)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + list[0].ID + "/attachments/1").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestMessagesStream(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+	// The HTTP client trims "Bearer " of an empty API key
+	apiKey := os.Getenv("SENDGRID_DEV_API_KEY")
+	os.Setenv("SENDGRID_DEV_API_KEY", "SG.stream")
+	defer os.Setenv("SENDGRID_DEV_API_KEY", apiKey)
+	server := httptest.NewServer(route.Init())
+	defer server.Close()
+
+	send := func(to string) {
+		body := `{
+			"personalizations": [{"to": [{"email": "` + to + `"}], "custom_args": {"order": "1"}}],
+			"from": {"email": "from@example.com"},
+			"subject": "Subject",
+			"content": [{"type": "text/plain", "value": "Content"}],
+			"categories": ["stream"]
+		}`
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/mail/send", strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+os.Getenv("SENDGRID_DEV_API_KEY"))
+		request.Header.Set("Content-Type", "application/json")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusAccepted {
+			t.Fatalf("unexpected status %d", response.StatusCode)
+		}
+	}
+
+	// OK (Server-Sent Events filtered by recipient)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/dev/messages/stream?to=alice@example.com&category=stream&custom_arg=order:1", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", response.Header.Get("Content-Type"))
+	}
+	send("bob@example.com")
+	send("alice@example.com")
+
+	reader := bufio.NewReader(response.Body)
+	types := []string{}
+	for len(types) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+			var item stream.Item
+			if err := json.Unmarshal([]byte(data), &item); err != nil {
+				t.Fatal(err)
+			}
+			switch item.Type {
+			case stream.TypeMessage:
+				if item.Message.To[0].Email != "alice@example.com" {
+					t.Fatalf("unexpected message %+v", item.Message)
+				}
+			case stream.TypeEvent:
+				if item.Event["email"] != "alice@example.com" {
+					t.Fatalf("unexpected event %+v", item.Event)
+				}
+			}
+			types = append(types, item.Type)
+		}
+	}
+	if strings.Join(types, ",") != "message,event,event" {
+		t.Fatalf("unexpected items %v", types)
+	}
+
+	// OK (WebSocket)
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/dev/messages/stream?type=message", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	send("carol@example.com")
+	var item stream.Item
+	if err := websocket.JSON.Receive(ws, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != stream.TypeMessage || item.Message.To[0].Email != "carol@example.com" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	// OK (items of the subuser only with the on-behalf-of header)
+	inst := instance.New(func(key string) string { return "" })
+	inst.Subusers.Create("customer", "customer@example.com")
+	subuserServer := httptest.NewServer(route.New(inst))
+	defer subuserServer.Close()
+	request, _ = http.NewRequestWithContext(ctx, http.MethodGet, subuserServer.URL+"/dev/messages/stream", nil)
+	request.Header.Set("On-Behalf-Of", "customer")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	for _, subuser := range []string{"other", "customer"} {
+		message := inst.Messages.Add(messages.Message{Subuser: subuser, To: []messages.Address{{Email: subuser + "@example.com"}}})
+		inst.Dispatcher.Publish(webhook.NewEvent("delivered", message, subuser+"@example.com", nil))
+	}
+	reader = bufio.NewReader(response.Body)
+	emails := []string{}
+	for len(emails) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+			var item stream.Item
+			if err := json.Unmarshal([]byte(data), &item); err != nil {
+				t.Fatal(err)
+			}
+			if item.Message != nil {
+				emails = append(emails, item.Message.To[0].Email)
+			} else {
+				emails = append(emails, item.Event["email"].(string))
+			}
+		}
+	}
+	if strings.Join(emails, ",") != "customer@example.com,customer@example.com" {
+		t.Fatalf("unexpected items %v", emails)
+	}
+
+	// OK (slow subscriber is closed after the buffered items)
+	subscriber := inst.Hub.Subscribe(stream.Filter{Type: stream.TypeMessage})
+	defer inst.Hub.Unsubscribe(subscriber)
+	for i := 0; i < 300; i++ {
+		inst.Messages.Add(messages.Message{To: []messages.Address{{Email: "slow@example.com"}}})
+	}
+	received := 0
+	for range subscriber.C {
+		received++
+	}
+	if received != 256 {
+		t.Fatalf("unexpected count of items %d", received)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+	reset := func() {
+		messages.Default.DeleteAll()
+		webhook.Default.Restore(nil)
+		activity.Default.DeleteAll()
+		templates.DefaultRegistry.Restore(map[string][]templates.Template{"": nil})
+		for _, list := range suppression.Lists {
+			suppression.Default.DeleteAll(list)
+		}
+		asm.DefaultRegistry.Restore(map[string]asm.StoreSnapshot{"": {}})
+		apikeys.Default.Restore(nil)
+		subusers.Default.Restore(nil)
+	}
+	reset()
+	defer reset()
+
+	// OK (save and load the stores)
+	dir := t.TempDir()
+	message := messages.Default.Add(messages.Message{
+		From:    messages.Address{Email: "from@example.com"},
+		To:      []messages.Address{{Email: "to@example.com"}},
+		Subject: "Subject",
+		Request: json.RawMessage(`{"subject":"Subject"}`),
+		Raw:     []byte("Subject: Subject\r\n\r\nContent\r\n"),
+	})
+	webhook.Default.Restore(webhook.NewEvents("delivered", message, nil))
+	activity.Default.Add(message, "to@example.com", "", 0)
+	template := templates.Default.Create("Template", templates.GenerationDynamic)
+	templates.Default.AddVersion(template.ID, templates.Version{Name: "First", Subject: "First"})
+	version, _ := templates.Default.AddVersion(template.ID, templates.Version{Name: "Second", Subject: "Hello {{name}}"})
+	templates.Default.Activate(template.ID, version.ID)
+	suppression.Default.Add(suppression.Bounces, suppression.Suppression{Email: "bounce@example.com"})
+	group := asm.Default.Create(asm.Group{Name: "Group"})
+	asm.Default.AddSuppressions(group.ID, []string{"unsubscribe@example.com"})
+	key := apikeys.Default.Create("Key", []string{"mail.send"})
+	subusers.Default.Create("subuser", "subuser@example.com")
+
+	persister := &persist.Persister{Dir: dir}
+	if err := persister.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reset()
+	if err := (&persist.Persister{Dir: dir}).Load(); err != nil {
+		t.Fatal(err)
+	}
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/" + message.ID + "/raw").
+		Expect(t).
+		Body("Subject: Subject\r\n\r\nContent\r\n").
+		Status(http.StatusOK).
+		End()
+	if loaded, _ := messages.Default.Get(message.ID); string(loaded.Request) != `{"subject":"Subject"}` {
+		t.Fatalf("unexpected request %s", loaded.Request)
+	}
+	if events := webhook.Default.History(message.ID); len(events) != 1 || events[0].Time().IsZero() {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if _, ok := activity.Default.Get("", message.ID); !ok {
+		t.Fatal("activity is not loaded")
+	}
+	if loaded, ok := templates.Default.Get(template.ID); !ok || len(loaded.Versions) != 2 {
+		t.Fatalf("template is not loaded %+v", loaded)
+	}
+	if _, active, ok := templates.Default.Active(template.ID); !ok || active.ID != version.ID || active.Subject != "Hello {{name}}" {
+		t.Fatalf("unexpected active version %+v", active)
+	}
+	if _, ok := suppression.Default.Get(suppression.Bounces, "bounce@example.com"); !ok {
+		t.Fatal("suppression is not loaded")
+	}
+	if !asm.Default.IsSuppressed(group.ID, "unsubscribe@example.com") {
+		t.Fatal("group suppression is not loaded")
+	}
+	if next := asm.Default.Create(asm.Group{Name: "Next"}); next.ID != group.ID+1 {
+		t.Fatalf("unexpected group ID %d", next.ID)
+	}
+	if loaded, ok := apikeys.Default.Find(key.Key); !ok || loaded.ID != key.ID {
+		t.Fatal("API key is not loaded")
+	}
+	if _, ok := subusers.Default.Get("subuser"); !ok {
+		t.Fatal("subuser is not loaded")
+	}
+
+	// OK (missing files are skipped)
+	if err := (&persist.Persister{Dir: filepath.Join(dir, "missing")}).Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// OK (retention by age and count)
+	reset()
+	old := messages.Default.Add(messages.Message{Subject: "Old", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	activity.Default.Add(old, "to@example.com", "", 0)
+	for i := 0; i < 3; i++ {
+		messages.Default.Add(messages.Message{Subject: strconv.Itoa(i), CreatedAt: time.Now().Add(time.Duration(i-3) * time.Minute)})
+	}
+	persister = &persist.Persister{Dir: dir, MaxAge: time.Hour}
+	if err := persister.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := messages.Default.Get(old.ID); ok {
+		t.Fatal("old message is not deleted")
+	}
+	if _, ok := activity.Default.Get("", old.ID); ok {
+		t.Fatal("activity of old message is not deleted")
+	}
+	persister.MaxMessages = 2
+	if err := persister.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reset()
+	if err := (&persist.Persister{Dir: dir}).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if list := messages.Default.List(messages.Filter{}); len(list) != 2 || list[0].Subject != "1" || list[1].Subject != "2" {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+
+	// OK (one file per message, written once)
+	files, _ := filepath.Glob(filepath.Join(dir, persist.MessagesDir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("unexpected message files %v", files)
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(files[0], modTime, modTime)
+	if err := persister.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(files[0]); err != nil || !info.ModTime().Equal(modTime) {
+		t.Fatal("saved message file is written again")
+	}
+
+	// NG (broken file)
+	os.WriteFile(files[0], []byte("{"), 0o600)
+	if err := (&persist.Persister{Dir: dir}).Load(); err == nil || !strings.HasPrefix(err.Error(), persist.MessagesDir) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	os.Setenv("SENDGRID_DEV_TEST", "1")
+	messages.Default.DeleteAll()
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		apitest.New().
+			Handler(route.Init()).
+			Post("/v3/mail/send").
+			Headers(map[string]string{"Authorization": "Bearer " + os.Getenv("SENDGRID_DEV_API_KEY")}).
+			JSON(`{
+				"personalizations": [{
+					"to": [{
+						"email": "` + to + `"
+					}]
+				}],
+				"from": {
+					"email": "from@example.com"
+				},
+				"subject": "Subject",
+				"content": [{
+					"type": "text/plain",
+					"value": "From the first line"
+				}]
+			}`).
+			Expect(t).
+			Status(http.StatusAccepted).
+			End()
+	}
+	list := messages.Default.List(messages.Filter{})
+	if len(list) != 2 {
+		t.Fatalf("unexpected messages %+v", list)
+	}
+	message := list[0]
+
+	// OK (.eml of a message)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/"+message.ID+"/eml").
+		Expect(t).
+		Header("Content-Type", "message/rfc822").
+		Header("Content-Disposition", "attachment; filename="+message.ID+".eml").
+		Body(string(message.Raw)).
+		Status(http.StatusOK).
+		End()
+
+	// NG (message not found)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/unknown/eml").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+
+	// OK (mbox filtered by recipient)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/export").
+		Query("to", "alice@example.com").
+		Expect(t).
+		Header("Content-Type", "application/mbox").
+		Assert(func(response *http.Response, request *http.Request) error {
+			body, _ := io.ReadAll(response.Body)
+			if !strings.HasPrefix(string(body), "From from@example.com ") || strings.Count(string(body), "\nFrom ") != 0 ||
+				!strings.Contains(string(body), "\n>From the first line") || !strings.Contains(string(body), "To: <alice@example.com>") {
+				t.Fatalf("unexpected mbox %s", body)
+			}
+			return nil
+		}).
+		Status(http.StatusOK).
+		End()
+
+	// OK (zip of Maildir)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/export").
+		Query("format", "maildir").
+		Expect(t).
+		Header("Content-Type", "application/zip").
+		Assert(func(response *http.Response, request *http.Request) error {
+			body, _ := io.ReadAll(response.Body)
+			archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, file := range archive.File {
+				if strings.HasPrefix(file.Name, "messages/new/") && !file.FileInfo().IsDir() {
+					names = append(names, file.Name)
+				}
+			}
+			if len(names) != 2 || !strings.Contains(names[0], message.ID) {
+				t.Fatalf("unexpected files %v", names)
+			}
+			return nil
+		}).
+		Status(http.StatusOK).
+		End()
+
+	// NG (invalid format)
+	apitest.New().
+		Handler(route.Init()).
+		Get("/dev/messages/export").
+		Query("format", "pst").
+		Expect(t).
+		Body(`{"errors":[{"message":"format must be one of mbox, maildir","field":"format","help":null}]}`).
+		Status(http.StatusBadRequest).
+		End()
+
+	// OK (export command reads the data directory)
+	dir := t.TempDir()
+	if err := (&persist.Persister{Dir: dir}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	if err := export([]string{"-data", dir, "-format", "eml", "-id", message.ID}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != string(message.Raw) {
+		t.Fatalf("unexpected eml %s", stdout.String())
+	}
+	mbox := filepath.Join(dir, "messages.mbox")
+	if err := export([]string{"-data", dir, "-to", "bob@example.com", "-o", mbox}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(mbox); strings.Count(string(data), "From from@example.com ") != 1 || !strings.Contains(string(data), "To: <bob@example.com>") {
+		t.Fatalf("unexpected mbox %s", data)
+	}
+	maildir := filepath.Join(dir, "Maildir")
+	if err := export([]string{"-data", dir, "-format", "maildir", "-o", maildir}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(filepath.Join(maildir, "new")); len(files) != 2 {
+		t.Fatalf("unexpected Maildir %v", files)
+	}
+
+	// NG (export command without message ID)
+	if err := export([]string{"-data", dir, "-format", "eml"}, &stdout); err == nil || err.Error() != "-id is required for eml" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSendgriddevServer(t *testing.T) {
+	send := func(t *testing.T, server *sendgriddev.Server, to string, sendAt int64) {
+		body := `{
+			"personalizations": [{"to": [{"email": "` + to + `"}]}],
+			"from": {"email": "from@example.com"},
+			"subject": "Subject",
+			"content": [{"type": "text/html", "value": "<a href=\"https://example.com\">Link</a>"}],
+			"send_at": ` + strconv.FormatInt(sendAt, 10) + `,
+			"tracking_settings": {"click_tracking": {"enable": true}}
+		}`
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/mail/send", strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+server.APIKey)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusAccepted {
+			t.Fatalf("unexpected status %d", response.StatusCode)
+		}
+	}
+	messages.Default.DeleteAll()
+
+	t.Run("close", func(t *testing.T) {
+		posts := 0
+		var mu sync.Mutex
+		webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			posts++
+			mu.Unlock()
+		}))
+		defer webhookServer.Close()
+
+		// OK (scheduled messages and pending events are not sent after Close)
+		server := sendgriddev.NewServer(sendgriddev.Options{
+			EventWebhookURL: webhookServer.URL,
+			Env:             map[string]string{"SENDGRID_DEV_EVENT_WEBHOOK_BATCH_INTERVAL": "500ms"},
+		})
+		send(t, server, "now@example.com", 0)
+		send(t, server, "later@example.com", time.Now().Add(time.Second).Unix())
+		server.Close()
+		time.Sleep(2 * time.Second)
+
+		server.AssertNotSent(t, sendgriddev.Filter{To: "later@example.com"})
+		mu.Lock()
+		defer mu.Unlock()
+		if posts != 0 {
+			t.Fatalf("event webhook posted %d times after Close", posts)
+		}
+	})
+
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		to := to
+		t.Run(to, func(t *testing.T) {
+			t.Parallel()
+
+			// OK (servers share nothing)
+			server := sendgriddev.NewServer(sendgriddev.Options{APIKey: "SG." + to, EventWebhookEvents: []string{"processed", "delivered", "click"}})
+			defer server.Close()
+			send(t, server, to, 0)
+			message := server.AssertSent(t, sendgriddev.Filter{To: to})
+			server.AssertMessageCount(t, sendgriddev.Filter{}, 1)
+			server.AssertEvent(t, message.ID, "delivered")
+			server.AssertEvent(t, message.ID, "click")
+			if !strings.Contains(message.HTML, server.URL+"/dev/track/click?token=") {
+				t.Fatalf("unexpected tracking link %s", message.HTML)
+			}
+
+			// OK (scheduled send by the clock of the server)
+			server.Reset()
+			send(t, server, to, time.Now().Add(time.Hour).Unix())
+			server.AssertNotSent(t, sendgriddev.Filter{})
+			server.AdvanceClock(2 * time.Hour)
+			server.AssertSent(t, sendgriddev.Filter{To: to})
+
+			// NG (API key of another server)
+			request, _ := http.NewRequest(http.MethodGet, server.URL+"/v3/templates", nil)
+			request.Header.Set("Authorization", "Bearer "+sendgriddev.DefaultAPIKey)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("unexpected status %d", response.StatusCode)
+			}
+		})
+	}
+
+	t.Cleanup(func() {
+		if list := messages.Default.List(messages.Filter{}); len(list) != 0 {
+			t.Fatalf("default store has messages %+v", list)
+		}
+	})
+}
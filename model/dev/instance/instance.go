@@ -0,0 +1,108 @@
+package instance
+
+import (
+	"crypto/rand"
+	"os"
+	"sync"
+
+	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/stream"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/activity"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/apikeys"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/schedule"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/subusers"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Key of the instance in the echo context
+const contextKey = "sendgrid-dev.instance"
+
+// Instance is the configuration and the stores which the API works on.
+// Instances created by New share nothing, so that several servers can run in one process.
+type Instance struct {
+	// Get setting by the name of the environment variable, e.g. "SENDGRID_DEV_API_KEY"
+	Getenv       func(key string) string
+	Messages     *messages.Store
+	Dispatcher   *webhook.Dispatcher
+	Activity     *activity.Store
+	Templates    *templates.Registry
+	Suppressions *suppression.Registry
+	Groups       *asm.Registry
+	APIKeys      *apikeys.Store
+	Subusers     *subusers.Store
+	Scheduler    *schedule.Scheduler
+	Hub          *stream.Hub
+
+	tokenKeyOnce sync.Once
+	tokenKey     []byte
+}
+
+// Default instance of the server, configured by the environment variables
+var Default = &Instance{
+	Getenv:       os.Getenv,
+	Messages:     messages.Default,
+	Dispatcher:   webhook.Default,
+	Activity:     activity.Default,
+	Templates:    templates.DefaultRegistry,
+	Suppressions: suppression.DefaultRegistry,
+	Groups:       asm.DefaultRegistry,
+	APIKeys:      apikeys.Default,
+	Subusers:     subusers.Default,
+	Scheduler:    schedule.Default,
+	Hub:          stream.Default,
+}
+
+// Create instance with empty stores, which gets the settings with getenv
+func New(getenv func(key string) string) *Instance {
+	dispatcher := webhook.NewDispatcher(&webhook.Signer{}, getenv)
+	store := messages.NewStore()
+	return &Instance{
+		Getenv:       getenv,
+		Messages:     store,
+		Dispatcher:   dispatcher,
+		Activity:     activity.NewStore(dispatcher.History),
+		Templates:    templates.NewRegistry(templates.NewStore()),
+		Suppressions: suppression.NewRegistry(suppression.NewStore()),
+		Groups:       asm.NewRegistry(asm.NewStore()),
+		APIKeys:      apikeys.NewStore(),
+		Subusers:     subusers.NewStore(),
+		Scheduler:    schedule.NewScheduler(),
+		Hub:          stream.NewHub(store, dispatcher),
+	}
+}
+
+// Get key which signs the tokens of the tracking and unsubscribe links.
+// SENDGRID_DEV_TOKEN_KEY, or a random key which changes on restart.
+func (i *Instance) TokenKey() []byte {
+	i.tokenKeyOnce.Do(func() {
+		if key := i.Getenv("SENDGRID_DEV_TOKEN_KEY"); key != "" {
+			i.tokenKey = []byte(key)
+			return
+		}
+		i.tokenKey = make([]byte, 32)
+		rand.Read(i.tokenKey)
+	})
+	return i.tokenKey
+}
+
+// Middleware which makes handlers work on instance
+func Middleware(instance *Instance) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKey, instance)
+			return next(c)
+		}
+	}
+}
+
+// Get instance of the request. It is Default without Middleware.
+func From(c echo.Context) *Instance {
+	if instance, ok := c.Get(contextKey).(*Instance); ok {
+		return instance
+	}
+	return Default
+}
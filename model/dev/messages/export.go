@@ -0,0 +1,108 @@
+package messages
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Formats of exported messages
+const (
+	FormatEML     = "eml"
+	FormatMbox    = "mbox"
+	FormatMaildir = "maildir"
+)
+
+// Characters replaced in file names
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Lines which are quoted with ">" in mbox (mboxrd)
+var mboxFromLine = regexp.MustCompile(`(?m)^(>*From )`)
+
+// Raw MIME of message as RFC 5322 (.eml) with CRLF line endings
+func (message Message) EML() []byte {
+	raw := bytes.ReplaceAll(message.Raw, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+}
+
+// Name of the .eml file of message
+func (message Message) EMLFilename() string {
+	return unsafeFilename.ReplaceAllString(message.ID, "_") + ".eml"
+}
+
+// Write messages to w as an mbox file (mboxrd, LF line endings)
+func WriteMbox(w io.Writer, list []Message) error {
+	for _, message := range list {
+		sender := message.From.Email
+		if sender == "" {
+			sender = "MAILER-DAEMON"
+		}
+		raw := bytes.ReplaceAll(message.Raw, []byte("\r\n"), []byte("\n"))
+		raw = mboxFromLine.ReplaceAll(raw, []byte(">$1"))
+		if !bytes.HasSuffix(raw, []byte("\n")) {
+			raw = append(raw, '\n')
+		}
+
+		if _, err := fmt.Fprintf(w, "From %s %s\n", sender, message.CreatedAt.UTC().Format(time.ANSIC)); err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write messages to the "new" directory of the Maildir dir, which is created when missing
+func WriteMaildir(dir string, list []Message) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0777); err != nil {
+			return err
+		}
+	}
+	for _, message := range list {
+		name := maildirFilename(message)
+		tmp := filepath.Join(dir, "tmp", name)
+		if err := os.WriteFile(tmp, message.EML(), 0666); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "new", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write messages to w as a zip archive of a Maildir tree under root
+func WriteMaildirZip(w io.Writer, root string, list []Message) error {
+	archive := zip.NewWriter(w)
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if _, err := archive.Create(root + "/" + sub + "/"); err != nil {
+			return err
+		}
+	}
+	for _, message := range list {
+		header := &zip.FileHeader{Name: root + "/new/" + maildirFilename(message), Method: zip.Deflate, Modified: message.CreatedAt}
+		file, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(message.EML()); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Unique name "<time>.<id>.sendgrid-dev", which sorts by CreatedAt
+func maildirFilename(message Message) string {
+	return fmt.Sprintf("%d.%s.sendgrid-dev", message.CreatedAt.UnixNano(), unsafeFilename.ReplaceAllString(message.ID, "_"))
+}
@@ -0,0 +1,239 @@
+package messages
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Address struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type Message struct {
+	ID         string            `json:"id"`
+	XMessageID string            `json:"x_message_id"`
+	SMTPID     string            `json:"smtp_id"`
+	From       Address           `json:"from"`
+	ReplyTo    *Address          `json:"reply_to"`
+	To         []Address         `json:"to"`
+	Cc         []Address         `json:"cc"`
+	Bcc        []Address         `json:"bcc"`
+	Subject    string            `json:"subject"`
+	Text       string            `json:"text"`
+	HTML       string            `json:"html"`
+	Categories []string          `json:"categories"`
+	CustomArgs map[string]string `json:"custom_args"`
+	Headers    map[string]string `json:"headers"`
+	// Data of the personalization which the subject and content were rendered with
+	Substitutions       map[string]string      `json:"substitutions,omitempty"`
+	DynamicTemplateData map[string]interface{} `json:"dynamic_template_data,omitempty"`
+	Subuser             string                 `json:"subuser,omitempty"`
+	CreatedAt           time.Time              `json:"created_at"`
+	// Original JSON of the /v3/mail/send request, empty for messages captured by SMTP
+	Request json.RawMessage `json:"-"`
+	Raw     []byte          `json:"-"`
+}
+
+// Filter for List. Empty fields match every message.
+type Filter struct {
+	To       string
+	From     string
+	Subject  string
+	Category string
+	// Username of the subuser (exact)
+	Subuser string
+}
+
+type Store struct {
+	mu        sync.RWMutex
+	messages  map[string]*Message
+	listeners []func(Message)
+}
+
+// Default store filled by mail/send
+var Default = NewStore()
+
+func NewStore() *Store {
+	return &Store{messages: map[string]*Message{}}
+}
+
+// Add message. ID and CreatedAt are set when empty.
+func (s *Store) Add(message Message) Message {
+	if message.XMessageID == "" {
+		message.XMessageID = NewXMessageID()
+	}
+	if message.ID == "" {
+		message.ID = NewID(message.XMessageID, 0)
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	s.messages[message.ID] = &message
+	// Listeners are called without the lock, so that they can call the store
+	listeners := append([]func(Message){}, s.listeners...)
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(message)
+	}
+	return message
+}
+
+// Call listener with every added message. listener is called without the lock, so it may call the store.
+func (s *Store) Listen(listener func(Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+// Get message by ID
+func (s *Store) Get(id string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.messages[id]
+	if !ok {
+		return Message{}, false
+	}
+	return *message, true
+}
+
+// List messages matching filter, oldest first
+func (s *Store) List(filter Filter) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Message{}
+	for _, message := range s.messages {
+		if filter.Match(*message) {
+			list = append(list, *message)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Delete message by ID
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[id]; !ok {
+		return false
+	}
+	delete(s.messages, id)
+	return true
+}
+
+// Delete all messages
+func (s *Store) DeleteAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = map[string]*Message{}
+}
+
+// Get all messages, oldest first
+func (s *Store) Snapshot() []Message {
+	return s.List(Filter{})
+}
+
+// Replace all messages without notifying the listeners
+func (s *Store) Restore(list []Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = map[string]*Message{}
+	for i := range list {
+		s.messages[list[i].ID] = &list[i]
+	}
+}
+
+// Delete messages created before t
+func (s *Store) DeleteBefore(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, message := range s.messages {
+		if message.CreatedAt.Before(t) {
+			delete(s.messages, id)
+		}
+	}
+}
+
+// Get CreatedAt of the oldest message of the newest max messages. It is zero when there are not more than max messages.
+func (s *Store) OldestOf(max int) time.Time {
+	list := s.List(Filter{})
+	if len(list) <= max {
+		return time.Time{}
+	}
+	return list[len(list)-max].CreatedAt
+}
+
+// Match message with filter (case-insensitive partial match, category and subuser are exact)
+func (filter Filter) Match(message Message) bool {
+	if filter.To != "" && !matchAddresses(filter.To, message.To, message.Cc, message.Bcc) {
+		return false
+	}
+	if filter.From != "" && !matchAddresses(filter.From, []Address{message.From}) {
+		return false
+	}
+	if filter.Subject != "" && !contains(message.Subject, filter.Subject) {
+		return false
+	}
+	if filter.Subuser != "" && !strings.EqualFold(message.Subuser, filter.Subuser) {
+		return false
+	}
+	if filter.Category != "" {
+		found := false
+		for _, category := range message.Categories {
+			if category == filter.Category {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAddresses(query string, lists ...[]Address) bool {
+	for _, list := range lists {
+		for _, address := range list {
+			if contains(address.Email, query) || contains(address.Name, query) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Generate X-Message-Id of a request (22 characters like SendGrid)
+func NewXMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Generate sg_message_id of the personalization at index
+func NewID(xMessageID string, index int) string {
+	return xMessageID + ".filterdrecv-sendgrid-dev-" + strings.ToUpper(strconv.FormatInt(time.Now().Unix(), 16)) + "." + strconv.Itoa(index)
+}
@@ -0,0 +1,228 @@
+package messages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+var wordDecoder = mime.WordDecoder{}
+
+// Part of a MIME message
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"type"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
+	Size        int    `json:"size"`
+	Content     []byte `json:"-"`
+}
+
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Parse a MIME message (RFC 5322) received by SMTP.
+// ID is X-SG-Message-Id of messages sent by sendgrid-dev. Recipients not in the To and Cc headers are Bcc. Categories and custom_args are read from X-SMTPAPI.
+func Parse(raw []byte, recipients []string) (Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Message{}, err
+	}
+
+	message := Message{
+		ID:         m.Header.Get("X-SG-Message-Id"),
+		XMessageID: m.Header.Get("X-Message-Id"),
+		SMTPID:     m.Header.Get("Message-Id"),
+		Subject:    decodeHeader(m.Header.Get("Subject")),
+		Raw:        raw,
+	}
+	if from := parseAddresses(m.Header.Get("From")); len(from) > 0 {
+		message.From = from[0]
+	}
+	if replyTo := parseAddresses(m.Header.Get("Reply-To")); len(replyTo) > 0 {
+		message.ReplyTo = &replyTo[0]
+	}
+	message.To = parseAddresses(m.Header.Get("To"))
+	message.Cc = parseAddresses(m.Header.Get("Cc"))
+	for _, recipient := range recipients {
+		if !hasAddress(recipient, message.To, message.Cc) {
+			message.Bcc = append(message.Bcc, Address{Email: recipient})
+		}
+	}
+
+	var smtpAPI struct {
+		Category   interface{}       `json:"category"`
+		UniqueArgs map[string]string `json:"unique_args"`
+	}
+	if json.Unmarshal([]byte(m.Header.Get("X-SMTPAPI")), &smtpAPI) == nil {
+		switch category := smtpAPI.Category.(type) {
+		case string:
+			message.Categories = []string{category}
+		case []interface{}:
+			for _, c := range category {
+				if s, ok := c.(string); ok {
+					message.Categories = append(message.Categories, s)
+				}
+			}
+		}
+		message.CustomArgs = smtpAPI.UniqueArgs
+	}
+
+	parts, err := walkParts(m.Header, m.Body)
+	for _, part := range parts {
+		switch {
+		case part.Filename != "" || part.Disposition == "attachment":
+		case part.ContentType == "text/plain" && message.Text == "":
+			message.Text = string(part.Content)
+		case part.ContentType == "text/html" && message.HTML == "":
+			message.HTML = string(part.Content)
+		}
+	}
+	return message, err
+}
+
+// Get attachments of the MIME message, including inline ones with a filename
+func (message Message) Attachments() ([]Attachment, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(message.Raw))
+	if err != nil {
+		return nil, err
+	}
+	parts, err := walkParts(m.Header, m.Body)
+	attachments := []Attachment{}
+	for _, part := range parts {
+		if part.Filename != "" || part.Disposition == "attachment" {
+			attachments = append(attachments, part)
+		}
+	}
+	return attachments, err
+}
+
+// Get header fields of the MIME message in order. Encoded words are decoded.
+func (message Message) Header() ([]HeaderField, error) {
+	reader := bufio.NewReader(bytes.NewReader(message.Raw))
+	fields := []HeaderField{}
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return decodeFields(fields), nil
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			// Folded line
+			fields[len(fields)-1].Value += " " + strings.TrimSpace(line)
+		} else if name, value, ok := strings.Cut(line, ":"); ok {
+			fields = append(fields, HeaderField{Name: name, Value: strings.TrimSpace(value)})
+		}
+		if err == io.EOF {
+			return decodeFields(fields), nil
+		}
+		if err != nil {
+			return decodeFields(fields), err
+		}
+	}
+}
+
+func decodeFields(fields []HeaderField) []HeaderField {
+	for i := range fields {
+		fields[i].Value = decodeHeader(fields[i].Value)
+	}
+	return fields
+}
+
+type headerGetter interface {
+	Get(key string) string
+}
+
+// Get the decoded leaf parts except multipart containers
+func walkParts(header headerGetter, body io.Reader) ([]Attachment, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := []Attachment{}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return parts, nil
+			}
+			if err != nil {
+				return parts, err
+			}
+			children, err := walkParts(part.Header, part)
+			parts = append(parts, children...)
+			if err != nil {
+				return parts, err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeBody(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return nil, err
+	}
+	part := Attachment{ContentType: mediaType, Filename: decodeHeader(params["name"]), Content: content, Size: len(content)}
+	if disposition, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Disposition = disposition
+		if dispositionParams["filename"] != "" {
+			part.Filename = dispositionParams["filename"]
+		}
+	}
+	part.ContentID = strings.Trim(header.Get("Content-Id"), "<>")
+	return []Attachment{part}, nil
+}
+
+func decodeBody(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func parseAddresses(value string) []Address {
+	if value == "" {
+		return nil
+	}
+	list, err := (&mail.AddressParser{WordDecoder: &wordDecoder}).ParseList(value)
+	if err != nil {
+		return nil
+	}
+	addresses := []Address{}
+	for _, address := range list {
+		addresses = append(addresses, Address{Email: address.Address, Name: address.Name})
+	}
+	return addresses
+}
+
+func hasAddress(email string, lists ...[]Address) bool {
+	for _, list := range lists {
+		for _, address := range list {
+			if strings.EqualFold(address.Email, email) {
+				return true
+			}
+		}
+	}
+	return false
+}
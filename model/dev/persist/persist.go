@@ -0,0 +1,342 @@
+package persist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/activity"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/apikeys"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/subusers"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Files in the data directory
+const (
+	// Directory of the messages, one "<id>.json" file per message
+	MessagesDir      = "messages"
+	EventsFile       = "events.json"
+	ActivityFile     = "activity.json"
+	TemplatesFile    = "templates.json"
+	SuppressionsFile = "suppressions.json"
+	AsmFile          = "asm.json"
+	APIKeysFile      = "api_keys.json"
+	SubusersFile     = "subusers.json"
+)
+
+// Characters replaced in the file names of messages
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Persister saves the default stores as JSON files in Dir and loads them on start.
+// Messages are written once each, since they do not change. Scheduled sends are not saved.
+type Persister struct {
+	Dir string
+	// Keep the newest MaxMessages messages (0 is unlimited)
+	MaxMessages int
+	// Keep messages younger than MaxAge (0 is unlimited)
+	MaxAge time.Duration
+	// Interval of Run
+	Interval time.Duration
+
+	mu sync.Mutex
+	// Last saved content of each file
+	saved map[string][]byte
+	// Saved message files
+	savedMessages map[string]bool
+}
+
+// Message with the fields which are not returned by the API
+type storedMessage struct {
+	messages.Message
+	Request json.RawMessage `json:"request,omitempty"`
+	Raw     []byte          `json:"raw,omitempty"`
+}
+
+// API key with its secret
+type storedKey struct {
+	apikeys.APIKey
+	Key string `json:"key"`
+}
+
+// Load the stores from the files of Dir. Missing files are skipped.
+func (p *Persister) Load() error {
+	list, err := p.readMessages()
+	if err != nil {
+		return err
+	}
+	messages.Default.Restore(list)
+
+	var events []webhook.Event
+	if err := p.read(EventsFile, &events); err != nil {
+		return err
+	}
+	webhook.Default.Restore(events)
+
+	var records []activity.Record
+	if err := p.read(ActivityFile, &records); err != nil {
+		return err
+	}
+	activity.Default.Restore(records)
+
+	var templateSnapshot map[string][]templates.Template
+	if err := p.read(TemplatesFile, &templateSnapshot); err != nil {
+		return err
+	}
+	templates.DefaultRegistry.Restore(templateSnapshot)
+
+	var suppressionSnapshot map[string]map[string][]suppression.Suppression
+	if err := p.read(SuppressionsFile, &suppressionSnapshot); err != nil {
+		return err
+	}
+	suppression.DefaultRegistry.Restore(suppressionSnapshot)
+
+	var asmSnapshot map[string]asm.StoreSnapshot
+	if err := p.read(AsmFile, &asmSnapshot); err != nil {
+		return err
+	}
+	asm.DefaultRegistry.Restore(asmSnapshot)
+
+	var storedKeys []storedKey
+	if err := p.read(APIKeysFile, &storedKeys); err != nil {
+		return err
+	}
+	keys := []apikeys.APIKey{}
+	for _, stored := range storedKeys {
+		key := stored.APIKey
+		key.Key = stored.Key
+		keys = append(keys, key)
+	}
+	apikeys.Default.Restore(keys)
+
+	var subuserList []subusers.Subuser
+	if err := p.read(SubusersFile, &subuserList); err != nil {
+		return err
+	}
+	subusers.Default.Restore(subuserList)
+
+	p.Prune()
+	return nil
+}
+
+// Delete messages, their events and activity over the retention limits
+func (p *Persister) Prune() {
+	var cutoff time.Time
+	if p.MaxAge > 0 {
+		cutoff = time.Now().Add(-p.MaxAge)
+	}
+	if p.MaxMessages > 0 {
+		if oldest := messages.Default.OldestOf(p.MaxMessages); oldest.After(cutoff) {
+			cutoff = oldest
+		}
+	}
+	if cutoff.IsZero() {
+		return
+	}
+
+	messages.Default.DeleteBefore(cutoff)
+	// Event timestamps are in seconds
+	webhook.Default.DeleteBefore(cutoff.Truncate(time.Second))
+	activity.Default.DeleteBefore(cutoff)
+}
+
+// Prune and save the stores to the files of Dir. Only changed files are written.
+func (p *Persister) Save() error {
+	p.Prune()
+
+	if err := p.writeMessages(messages.Default.Snapshot()); err != nil {
+		return err
+	}
+	storedKeys := []storedKey{}
+	for _, key := range apikeys.Default.Snapshot() {
+		storedKeys = append(storedKeys, storedKey{APIKey: key, Key: key.Key})
+	}
+
+	files := map[string]interface{}{
+		EventsFile:       webhook.Default.Snapshot(),
+		ActivityFile:     activity.Default.Snapshot(),
+		TemplatesFile:    templates.DefaultRegistry.Snapshot(),
+		SuppressionsFile: suppression.DefaultRegistry.Snapshot(),
+		AsmFile:          asm.DefaultRegistry.Snapshot(),
+		APIKeysFile:      storedKeys,
+		SubusersFile:     subusers.Default.Snapshot(),
+	}
+	for name, value := range files {
+		if err := p.write(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read the message files
+func (p *Persister) readMessages() ([]messages.Message, error) {
+	entries, err := os.ReadDir(filepath.Join(p.Dir, MessagesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []messages.Message{}
+	saved := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		name := filepath.Join(MessagesDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(p.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var stored storedMessage
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		message := stored.Message
+		message.Request = stored.Request
+		message.Raw = stored.Raw
+		list = append(list, message)
+		saved[entry.Name()] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.savedMessages = saved
+	return list, nil
+}
+
+// Write the files of new messages and remove the files of deleted messages
+func (p *Persister) writeMessages(list []messages.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	dir := filepath.Join(p.Dir, MessagesDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if p.savedMessages == nil {
+		// Files of the directory which were not loaded
+		p.savedMessages = map[string]bool{}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+				p.savedMessages[entry.Name()] = true
+			}
+		}
+	}
+
+	current := map[string]bool{}
+	for _, message := range list {
+		name := unsafeFilename.ReplaceAllString(message.ID, "_") + ".json"
+		current[name] = true
+		if p.savedMessages[name] {
+			continue
+		}
+		data, err := json.Marshal(storedMessage{Message: message, Request: message.Request, Raw: message.Raw})
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, name), data); err != nil {
+			return err
+		}
+		p.savedMessages[name] = true
+	}
+	for name := range p.savedMessages {
+		if current[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(p.savedMessages, name)
+	}
+	return nil
+}
+
+// Save every Interval until stop is closed, and once more on stop
+func (p *Persister) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Save(); err != nil {
+				log.Println("save data failed:", err)
+			}
+		case <-stop:
+			if err := p.Save(); err != nil {
+				log.Println("save data failed:", err)
+			}
+			return
+		}
+	}
+}
+
+func (p *Persister) read(name string, value interface{}) error {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.saved == nil {
+		p.saved = map[string][]byte{}
+	}
+	p.saved[name] = data
+	return nil
+}
+
+// Write the file when its content changed
+func (p *Persister) write(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bytes.Equal(p.saved[name], data) {
+		return nil
+	}
+
+	if err := writeFile(filepath.Join(p.Dir, name), data); err != nil {
+		return err
+	}
+	if p.saved == nil {
+		p.saved = map[string][]byte{}
+	}
+	p.saved[name] = data
+	return nil
+}
+
+// Write the file through a temporary file, so that a crash never leaves a partial file
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,286 @@
+package smtpd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+)
+
+// Max size of a message (30MB like SendGrid)
+const maxMessageSize = 30 * 1024 * 1024
+
+// Max recipients of a message
+const maxRecipients = 1000
+
+// Server captures messages sent by SMTP into the message store of Instance
+type Server struct {
+	Addr string
+	// AUTH is required when Username is set
+	Username string
+	Password string
+	// Instance to add messages, activity and events to (instance.Default by default)
+	Instance *instance.Instance
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+type session struct {
+	server        *Server
+	text          *textproto.Conn
+	authenticated bool
+	// MAIL was accepted. from is empty for the null sender.
+	mail       bool
+	from       string
+	recipients []string
+}
+
+// Listen on Addr and serve connections until Close
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve connections of listener until Close
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Get address of the listener, which is useful with port 0
+func (s *Server) ListenAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop listening
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	session := &session{server: s, text: textproto.NewConn(conn), authenticated: s.Username == ""}
+	session.reply(220, "sendgrid-dev ESMTP ready")
+	for {
+		line, err := session.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		if !session.command(strings.ToUpper(verb), strings.TrimSpace(arg)) {
+			return
+		}
+	}
+}
+
+// Handle command. Returns false to close the connection.
+func (s *session) command(verb string, arg string) bool {
+	switch verb {
+	case "HELO":
+		s.reset()
+		s.reply(250, "sendgrid-dev")
+	case "EHLO":
+		s.reset()
+		s.reply(250, "sendgrid-dev", "8BITMIME", "PIPELINING", fmt.Sprintf("SIZE %d", maxMessageSize), "AUTH PLAIN LOGIN")
+	case "AUTH":
+		s.auth(arg)
+	case "MAIL":
+		switch {
+		case !s.authenticated:
+			s.reply(530, "Authentication required")
+		case !strings.HasPrefix(strings.ToUpper(arg), "FROM:"):
+			s.reply(501, "Syntax: MAIL FROM:<address>")
+		default:
+			s.reset()
+			s.mail = true
+			s.from = parsePath(arg[len("FROM:"):])
+			s.reply(250, "OK")
+		}
+	case "RCPT":
+		switch {
+		case !s.mail:
+			s.reply(503, "Need MAIL before RCPT")
+		case !strings.HasPrefix(strings.ToUpper(arg), "TO:"):
+			s.reply(501, "Syntax: RCPT TO:<address>")
+		case len(s.recipients) >= maxRecipients:
+			s.reply(452, "Too many recipients")
+		default:
+			s.recipients = append(s.recipients, parsePath(arg[len("TO:"):]))
+			s.reply(250, "OK")
+		}
+	case "DATA":
+		if len(s.recipients) == 0 {
+			s.reply(503, "Need RCPT before DATA")
+			break
+		}
+		s.reply(354, "End data with <CR><LF>.<CR><LF>")
+		s.data()
+		s.reset()
+	case "RSET":
+		s.reset()
+		s.reply(250, "OK")
+	case "NOOP":
+		s.reply(250, "OK")
+	case "QUIT":
+		s.reply(221, "Bye")
+		return false
+	default:
+		s.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// AUTH PLAIN and LOGIN
+func (s *session) auth(arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var username, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			s.reply(334, "")
+			initial, _ = s.text.ReadLine()
+		}
+		decoded, err := base64.StdEncoding.DecodeString(initial)
+		fields := strings.Split(string(decoded), "\x00")
+		if err != nil || len(fields) != 3 {
+			s.reply(501, "Invalid AUTH PLAIN")
+			return
+		}
+		username, password = fields[1], fields[2]
+	case "LOGIN":
+		username = s.prompt("VXNlcm5hbWU6", initial)
+		password = s.prompt("UGFzc3dvcmQ6", "")
+	default:
+		s.reply(504, "Unrecognized authentication type")
+		return
+	}
+
+	if s.server.Username != "" && (username != s.server.Username || password != s.server.Password) {
+		s.reply(535, "Authentication credentials invalid")
+		return
+	}
+	s.authenticated = true
+	s.reply(235, "Authentication successful")
+}
+
+// Read a base64 response of AUTH LOGIN
+func (s *session) prompt(challenge string, initial string) string {
+	response := initial
+	if response == "" {
+		s.reply(334, challenge)
+		response, _ = s.text.ReadLine()
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(response)
+	return string(decoded)
+}
+
+func (s *session) data() {
+	dr := s.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dr, maxMessageSize+1))
+	if err != nil {
+		s.reply(451, "Read message failed")
+		return
+	}
+	if len(raw) > maxMessageSize {
+		// Discard the rest of the message up to the terminating "."
+		io.Copy(io.Discard, dr)
+		s.reply(552, "Message exceeds fixed maximum message size")
+		return
+	}
+
+	message, err := s.server.capture(raw, s.recipients)
+	if err != nil {
+		s.reply(554, "Invalid message: "+err.Error())
+		return
+	}
+	s.reply(250, "OK: queued as "+message.ID)
+}
+
+func (s *session) reset() {
+	s.mail = false
+	s.from = ""
+	s.recipients = nil
+}
+
+func (s *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		separator := " "
+		if i < len(lines)-1 {
+			separator = "-"
+		}
+		s.text.PrintfLine("%d%s%s", code, separator, line)
+	}
+}
+
+// Add message to the store and record it like an accepted send.
+// Messages sent by sendgrid-dev itself (with X-SG-Message-Id of a stored message) are not added twice.
+func (s *Server) capture(raw []byte, recipients []string) (messages.Message, error) {
+	inst := s.Instance
+	if inst == nil {
+		inst = instance.Default
+	}
+	store := inst.Messages
+
+	message, err := messages.Parse(raw, recipients)
+	if err != nil {
+		return message, err
+	}
+	if stored, ok := store.Get(message.ID); ok && message.ID != "" {
+		return stored, nil
+	}
+
+	message = store.Add(message)
+	for _, addresses := range [][]messages.Address{message.To, message.Cc, message.Bcc} {
+		for _, address := range addresses {
+			inst.Activity.Add(message, address.Email, "", 0)
+		}
+	}
+	inst.Dispatcher.PublishAccepted(message)
+	return message, nil
+}
+
+// "<address> SIZE=1000" to "address"
+func parsePath(path string) string {
+	path = strings.TrimSpace(path)
+	if end := strings.Index(path, ">"); strings.HasPrefix(path, "<") && end > 0 {
+		return path[1:end]
+	}
+	address, _, _ := strings.Cut(path, " ")
+	return address
+}
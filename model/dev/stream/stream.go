@@ -0,0 +1,191 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Types of items
+const (
+	TypeMessage = "message"
+	TypeEvent   = "event"
+)
+
+// Items buffered per subscriber. A subscriber whose buffer is full is unsubscribed.
+const bufferSize = 256
+
+// Item pushed to subscribers, an accepted message or a published event
+type Item struct {
+	Type    string            `json:"type"`
+	Message *messages.Message `json:"message,omitempty"`
+	Event   webhook.Event     `json:"event,omitempty"`
+	// Subuser of the message (of the event)
+	Subuser string `json:"-"`
+}
+
+// Filter of items. Empty fields match every item.
+type Filter struct {
+	Type string
+	// Recipient (exact, case-insensitive)
+	To       string
+	Category string
+	// custom_arg "key:value"
+	CustomArg string
+	Subuser   string
+}
+
+type Subscriber struct {
+	C      <-chan Item
+	c      chan Item
+	filter Filter
+}
+
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscriber]bool
+}
+
+// Default hub of the messages and events of mail/send
+var Default = NewHub(messages.Default, webhook.Default)
+
+// Create hub which pushes the messages added to store and the events published by dispatcher
+func NewHub(store *messages.Store, dispatcher *webhook.Dispatcher) *Hub {
+	h := &Hub{subscribers: map[*Subscriber]bool{}}
+	store.Listen(func(message messages.Message) {
+		h.Publish(Item{Type: TypeMessage, Message: &message, Subuser: message.Subuser})
+	})
+	dispatcher.Listen(func(event webhook.Event) {
+		item := Item{Type: TypeEvent, Event: event}
+		if id, _ := event["sg_message_id"].(string); id != "" {
+			message, _ := store.Get(id)
+			item.Subuser = message.Subuser
+		}
+		h.Publish(item)
+	})
+	return h
+}
+
+// Subscribe items matching filter until Unsubscribe
+func (h *Hub) Subscribe(filter Filter) *Subscriber {
+	c := make(chan Item, bufferSize)
+	subscriber := &Subscriber{C: c, c: c, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (h *Hub) Unsubscribe(subscriber *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[subscriber] {
+		delete(h.subscribers, subscriber)
+		close(subscriber.c)
+	}
+}
+
+// Push item to the subscribers whose filter matches.
+// A slow subscriber is closed instead of missing the item, C is closed after the buffered items.
+func (h *Hub) Publish(item Item) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for subscriber := range h.subscribers {
+		if !subscriber.filter.Match(item) {
+			continue
+		}
+		select {
+		case subscriber.c <- item:
+		default:
+			delete(h.subscribers, subscriber)
+			close(subscriber.c)
+		}
+	}
+}
+
+// Match item with filter
+func (filter Filter) Match(item Item) bool {
+	if filter.Type != "" && filter.Type != item.Type {
+		return false
+	}
+	if filter.Subuser != "" && filter.Subuser != item.Subuser {
+		return false
+	}
+	key, value, _ := strings.Cut(filter.CustomArg, ":")
+
+	if item.Message != nil {
+		message := item.Message
+		if filter.To != "" && !hasRecipient(filter.To, message.To, message.Cc, message.Bcc) {
+			return false
+		}
+		if filter.Category != "" && !contains(message.Categories, filter.Category) {
+			return false
+		}
+		if filter.CustomArg != "" && (message.CustomArgs == nil || message.CustomArgs[key] != value) {
+			return false
+		}
+		return true
+	}
+
+	event := item.Event
+	if email, _ := event["email"].(string); filter.To != "" && !strings.EqualFold(email, filter.To) {
+		return false
+	}
+	if filter.Category != "" {
+		switch category := event["category"].(type) {
+		case string:
+			if category != filter.Category {
+				return false
+			}
+		case []string:
+			if !contains(category, filter.Category) {
+				return false
+			}
+		case []interface{}:
+			// Events loaded from the data directory
+			if !containsValue(category, filter.Category) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	if argValue, _ := event[key].(string); filter.CustomArg != "" && argValue != value {
+		return false
+	}
+	return true
+}
+
+func hasRecipient(email string, lists ...[]messages.Address) bool {
+	for _, list := range lists {
+		for _, address := range list {
+			if strings.EqualFold(address.Email, email) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
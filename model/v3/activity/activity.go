@@ -0,0 +1,284 @@
+package activity
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Statuses of messages
+const (
+	StatusProcessed    = "processed"
+	StatusDelivered    = "delivered"
+	StatusNotDelivered = "not_delivered"
+)
+
+// Event names of the Email Activity Feed for the event types of the Event Webhook
+var eventNames = map[string]string{
+	"bounce":     "bounced",
+	"open":       "opened",
+	"click":      "clicked",
+	"spamreport": "spam_report",
+}
+
+// Message of the list
+type Message struct {
+	FromEmail     string `json:"from_email"`
+	MsgID         string `json:"msg_id"`
+	Subject       string `json:"subject"`
+	ToEmail       string `json:"to_email"`
+	Status        string `json:"status"`
+	OpensCount    int    `json:"opens_count"`
+	ClicksCount   int    `json:"clicks_count"`
+	LastEventTime string `json:"last_event_time"`
+}
+
+// Message with events
+type Detail struct {
+	FromEmail  string            `json:"from_email"`
+	MsgID      string            `json:"msg_id"`
+	Subject    string            `json:"subject"`
+	ToEmail    string            `json:"to_email"`
+	Status     string            `json:"status"`
+	TemplateID string            `json:"template_id"`
+	AsmGroupID int               `json:"asm_group_id"`
+	Categories []string          `json:"categories"`
+	UniqueArgs map[string]string `json:"unique_args"`
+	Events     []Event           `json:"events"`
+}
+
+type Event struct {
+	EventName     string `json:"event_name"`
+	Processed     string `json:"processed"`
+	Reason        string `json:"reason,omitempty"`
+	AttemptNum    int    `json:"attempt_num,omitempty"`
+	URL           string `json:"url,omitempty"`
+	BounceType    string `json:"bounce_type,omitempty"`
+	HTTPUserAgent string `json:"http_user_agent,omitempty"`
+	MXServer      string `json:"mx_server,omitempty"`
+}
+
+// Send to a recipient
+type Record struct {
+	Message    messages.Message `json:"message"`
+	Email      string           `json:"email"`
+	TemplateID string           `json:"template_id"`
+	AsmGroupID int              `json:"asm_group_id"`
+}
+
+type Store struct {
+	mu      sync.RWMutex
+	records []Record
+	history func(messageID string) []webhook.Event
+}
+
+// Default store filled by mail/send with the events of the default dispatcher
+var Default = NewStore(webhook.Default.History)
+
+// Create store. history gets the events of a message.
+func NewStore(history func(messageID string) []webhook.Event) *Store {
+	return &Store{history: history}
+}
+
+// Record the send of message to the recipient
+func (s *Store) Add(message messages.Message, email string, templateID string, asmGroupID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message.Raw = nil
+	message.Request = nil
+	if message.CreatedAt.IsZero() {
+		// Messages of dropped recipients are not added to the message store
+		message.CreatedAt = time.Now().UTC()
+	}
+	s.records = append(s.records, Record{Message: message, Email: email, TemplateID: templateID, AsmGroupID: asmGroupID})
+}
+
+// List messages of the subuser which match the query, by last_event_time desc
+func (s *Store) List(subuser string, query *Query, limit int) []Message {
+	details := []Detail{}
+	for _, record := range s.list(subuser) {
+		detail := s.detail(record)
+		if query == nil || query.Match(detail) {
+			details = append(details, detail)
+		}
+	}
+	sort.SliceStable(details, func(i, j int) bool {
+		return lastEventTime(details[i]).After(lastEventTime(details[j]))
+	})
+
+	list := []Message{}
+	for _, detail := range details {
+		if len(list) == limit {
+			break
+		}
+		list = append(list, detail.summary())
+	}
+	return list
+}
+
+// Get message of the subuser by msg_id. The first recipient is used when the message has many.
+func (s *Store) Get(subuser string, msgID string) (Detail, bool) {
+	for _, record := range s.list(subuser) {
+		if record.Message.ID == msgID {
+			return s.detail(record), true
+		}
+	}
+	return Detail{}, false
+}
+
+// Get events of the recipients recorded for the subuser
+func (s *Store) Events(subuser string) []webhook.Event {
+	events := []webhook.Event{}
+	for _, record := range s.list(subuser) {
+		for _, event := range s.history(record.Message.ID) {
+			if event["email"] == record.Email {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+// Get all records
+func (s *Store) Snapshot() []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Record{}, s.records...)
+}
+
+// Replace all records
+func (s *Store) Restore(records []Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append([]Record{}, records...)
+}
+
+// Delete records of the messages created before t
+func (s *Store) DeleteBefore(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []Record{}
+	for _, record := range s.records {
+		if !record.Message.CreatedAt.Before(t) {
+			records = append(records, record)
+		}
+	}
+	s.records = records
+}
+
+// Delete all records
+func (s *Store) DeleteAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = nil
+}
+
+func (s *Store) list(subuser string) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := []Record{}
+	for _, record := range s.records {
+		if record.Message.Subuser == subuser {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (s *Store) detail(record Record) Detail {
+	detail := Detail{
+		FromEmail:  record.Message.From.Email,
+		MsgID:      record.Message.ID,
+		Subject:    record.Message.Subject,
+		ToEmail:    record.Email,
+		Status:     StatusProcessed,
+		TemplateID: record.TemplateID,
+		AsmGroupID: record.AsmGroupID,
+		Categories: append([]string{}, record.Message.Categories...),
+		UniqueArgs: record.Message.CustomArgs,
+		Events:     []Event{},
+	}
+
+	delivered, notDelivered := false, false
+	for _, e := range s.history(record.Message.ID) {
+		if e["email"] != record.Email {
+			continue
+		}
+		eventType, _ := e["event"].(string)
+		event := Event{EventName: eventType, Processed: formatTime(e.Time())}
+		if name, ok := eventNames[eventType]; ok {
+			event.EventName = name
+		}
+		event.Reason, _ = e["reason"].(string)
+		event.URL, _ = e["url"].(string)
+		event.HTTPUserAgent, _ = e["useragent"].(string)
+		switch eventType {
+		case "delivered":
+			delivered = true
+			event.MXServer = "localhost"
+		case "deferred":
+			event.AttemptNum = 1
+		case "bounce":
+			notDelivered = true
+			event.BounceType = "hard"
+		case "dropped":
+			notDelivered = true
+		}
+		detail.Events = append(detail.Events, event)
+	}
+
+	switch {
+	case notDelivered:
+		detail.Status = StatusNotDelivered
+	case delivered:
+		detail.Status = StatusDelivered
+	}
+	return detail
+}
+
+func (detail Detail) summary() Message {
+	message := Message{
+		FromEmail:     detail.FromEmail,
+		MsgID:         detail.MsgID,
+		Subject:       detail.Subject,
+		ToEmail:       detail.ToEmail,
+		Status:        detail.Status,
+		LastEventTime: formatTime(lastEventTime(detail)),
+	}
+	message.OpensCount = detail.count("opened")
+	message.ClicksCount = detail.count("clicked")
+	return message
+}
+
+func (detail Detail) count(eventName string) int {
+	count := 0
+	for _, event := range detail.Events {
+		if event.EventName == eventName {
+			count++
+		}
+	}
+	return count
+}
+
+func lastEventTime(detail Detail) time.Time {
+	last := time.Time{}
+	for _, event := range detail.Events {
+		if t, err := time.Parse(time.RFC3339, event.Processed); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
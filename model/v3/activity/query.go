@@ -0,0 +1,475 @@
+package activity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query of the Email Activity Feed in the SendGrid query language, e.g.
+// to_email="to@example.com" AND status="delivered" AND last_event_time BETWEEN TIMESTAMP "2024-01-01T00:00:00Z" AND TIMESTAMP "2024-01-02T00:00:00Z"
+type Query struct {
+	root node
+}
+
+type node interface {
+	match(detail Detail) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ node node }
+
+type predicate struct {
+	field   string
+	op      string
+	values  []value
+	pattern *regexp.Regexp // LIKE and NOT LIKE
+}
+
+type value struct {
+	text     string
+	isString bool
+}
+
+type token struct {
+	kind string // "ident", "string", "number", "op", "(", ")", ","
+	text string
+}
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Fields which can be queried
+var queryFields = map[string]bool{
+	"msg_id": true, "from_email": true, "subject": true, "to_email": true, "status": true,
+	"template_id": true, "asm_group_id": true, "categories": true,
+	"last_event_time": true, "opens_count": true, "clicks_count": true,
+}
+
+// Fields which are arrays, Contains can only be used with them
+var arrayFields = map[string]bool{
+	"categories": true,
+}
+
+// Parse query
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+	return &Query{root: root}, nil
+}
+
+// Check if message matches query
+func (q *Query) Match(detail Detail) bool {
+	return q.root.match(detail)
+}
+
+func (n andNode) match(detail Detail) bool { return n.left.match(detail) && n.right.match(detail) }
+func (n orNode) match(detail Detail) bool  { return n.left.match(detail) || n.right.match(detail) }
+func (n notNode) match(detail Detail) bool { return !n.node.match(detail) }
+
+func (p predicate) match(detail Detail) bool {
+	switch field := fieldValue(detail, p.field).(type) {
+	case string:
+		return p.matchString(field, p.op)
+	case int:
+		return matchOrdered(float64(field), p.op, p.values, func(v value) (float64, bool) {
+			n, err := strconv.ParseFloat(v.text, 64)
+			return n, err == nil
+		})
+	case time.Time:
+		return matchOrdered(float64(field.Unix()), p.op, p.values, func(v value) (float64, bool) {
+			t, err := time.Parse(time.RFC3339, v.text)
+			return float64(t.Unix()), err == nil
+		})
+	case []string:
+		switch p.op {
+		case "IS NULL":
+			return len(field) == 0
+		case "IS NOT NULL":
+			return len(field) > 0
+		}
+		// A negated operator matches when no element matches the positive one
+		op, negated := strings.TrimPrefix(p.op, "NOT "), strings.HasPrefix(p.op, "NOT ")
+		if op == "!=" {
+			op, negated = "=", true
+		}
+		for _, s := range field {
+			if p.matchString(s, op) {
+				return !negated
+			}
+		}
+		return negated
+	}
+	return false
+}
+
+func fieldValue(detail Detail, field string) interface{} {
+	switch field {
+	case "msg_id":
+		return detail.MsgID
+	case "from_email":
+		return detail.FromEmail
+	case "subject":
+		return detail.Subject
+	case "to_email":
+		return detail.ToEmail
+	case "status":
+		return detail.Status
+	case "template_id":
+		return detail.TemplateID
+	case "asm_group_id":
+		return detail.AsmGroupID
+	case "categories":
+		return detail.Categories
+	case "last_event_time":
+		return lastEventTime(detail)
+	case "opens_count":
+		return detail.count("opened")
+	case "clicks_count":
+		return detail.count("clicked")
+	}
+	return nil
+}
+
+// Match string with op. CONTAINS is only parsed for array fields, so s is an element of the array.
+func (p predicate) matchString(s string, op string) bool {
+	switch op {
+	case "=", "CONTAINS":
+		return s == p.values[0].text
+	case "!=":
+		return s != p.values[0].text
+	case "LIKE":
+		return p.pattern.MatchString(s)
+	case "NOT LIKE":
+		return !p.pattern.MatchString(s)
+	case "IN", "NOT IN":
+		for _, v := range p.values {
+			if s == v.text {
+				return op == "IN"
+			}
+		}
+		return op == "NOT IN"
+	case "IS NULL":
+		return s == ""
+	case "IS NOT NULL":
+		return s != ""
+	}
+	return false
+}
+
+func matchOrdered(n float64, op string, values []value, parse func(v value) (float64, bool)) bool {
+	operands := []float64{}
+	for _, v := range values {
+		operand, ok := parse(v)
+		if !ok {
+			return false
+		}
+		operands = append(operands, operand)
+	}
+
+	switch op {
+	case "=":
+		return n == operands[0]
+	case "!=":
+		return n != operands[0]
+	case ">":
+		return n > operands[0]
+	case ">=":
+		return n >= operands[0]
+	case "<":
+		return n < operands[0]
+	case "<=":
+		return n <= operands[0]
+	case "BETWEEN":
+		return n >= operands[0] && n <= operands[1]
+	case "IN", "NOT IN":
+		for _, operand := range operands {
+			if n == operand {
+				return op == "IN"
+			}
+		}
+		return op == "NOT IN"
+	}
+	return false
+}
+
+// Compile SQL LIKE with % and _ (case-insensitive)
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("NOT") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if p.symbol("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("expected )")
+		}
+		return n, nil
+	}
+	return p.parsePredicate()
+}
+
+// field op value, field [NOT] IN (values), field BETWEEN value AND value, field IS [NOT] NULL or Contains(field, value)
+func (p *parser) parsePredicate() (node, error) {
+	if p.keyword("CONTAINS") {
+		if !p.symbol("(") {
+			return nil, p.errorf("expected (")
+		}
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(",") {
+			return nil, p.errorf("expected ,")
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("expected )")
+		}
+		if !arrayFields[field] {
+			return nil, fmt.Errorf("%w: Contains can not be used with %s", ErrInvalidQuery, field)
+		}
+		return predicate{field: field, op: "CONTAINS", values: []value{v}}, nil
+	}
+
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.keyword("IS"):
+		op := "IS NULL"
+		if p.keyword("NOT") {
+			op = "IS NOT NULL"
+		}
+		if !p.keyword("NULL") {
+			return nil, p.errorf("expected NULL")
+		}
+		return predicate{field: field, op: op}, nil
+	case p.keyword("BETWEEN"):
+		from, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.errorf("expected AND")
+		}
+		to, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return predicate{field: field, op: "BETWEEN", values: []value{from, to}}, nil
+	case p.keyword("LIKE"):
+		v, err := p.parseValue()
+		return predicate{field: field, op: "LIKE", values: []value{v}, pattern: likePattern(v.text)}, err
+	case p.keyword("IN"):
+		values, err := p.parseList()
+		return predicate{field: field, op: "IN", values: values}, err
+	case p.keyword("NOT"):
+		if p.keyword("LIKE") {
+			v, err := p.parseValue()
+			return predicate{field: field, op: "NOT LIKE", values: []value{v}, pattern: likePattern(v.text)}, err
+		}
+		if p.keyword("IN") {
+			values, err := p.parseList()
+			return predicate{field: field, op: "NOT IN", values: values}, err
+		}
+		return nil, p.errorf("expected LIKE or IN")
+	}
+
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != "op" {
+		return nil, p.errorf("expected operator")
+	}
+	op := p.tokens[p.pos].text
+	if op == "<>" {
+		op = "!="
+	}
+	p.pos++
+	v, err := p.parseValue()
+	return predicate{field: field, op: op, values: []value{v}}, err
+}
+
+func (p *parser) parseField() (string, error) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != "ident" {
+		return "", p.errorf("expected field")
+	}
+	field := strings.ToLower(p.tokens[p.pos].text)
+	if !queryFields[field] {
+		return "", p.errorf("unknown field " + field)
+	}
+	p.pos++
+	return field, nil
+}
+
+// "string", 'string', number or TIMESTAMP "2024-01-01T00:00:00Z"
+func (p *parser) parseValue() (value, error) {
+	p.keyword("TIMESTAMP")
+	if p.pos >= len(p.tokens) || (p.tokens[p.pos].kind != "string" && p.tokens[p.pos].kind != "number") {
+		return value{}, p.errorf("expected value")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return value{text: t.text, isString: t.kind == "string"}, nil
+}
+
+func (p *parser) parseList() ([]value, error) {
+	if !p.symbol("(") {
+		return nil, p.errorf("expected (")
+	}
+	values := []value{}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.symbol(")") {
+			return values, nil
+		}
+		if !p.symbol(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+func (p *parser) keyword(keyword string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "ident" && strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) symbol(symbol string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(message string) error {
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("%w: %s at %q", ErrInvalidQuery, message, p.tokens[p.pos].text)
+	}
+	return fmt.Errorf("%w: %s at end", ErrInvalidQuery, message)
+}
+
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, token{kind: string(c), text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidQuery)
+			}
+			tokens = append(tokens, token{kind: "string", text: s[i+1 : i+1+j]})
+			i += j + 2
+		case strings.HasPrefix(s[i:], "!=") || strings.HasPrefix(s[i:], "<>") || strings.HasPrefix(s[i:], ">=") || strings.HasPrefix(s[i:], "<="):
+			tokens = append(tokens, token{kind: "op", text: s[i : i+2]})
+			i += 2
+		case c == '=' || c == '<' || c == '>':
+			tokens = append(tokens, token{kind: "op", text: string(c)})
+			i++
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, token{kind: "number", text: s[i:j]})
+			i = j
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || (s[j] >= 'a' && s[j] <= 'z') || (s[j] >= 'A' && s[j] <= 'Z') || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, token{kind: "ident", text: s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, string(c))
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,246 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+)
+
+type APIKey struct {
+	ID     string   `json:"api_key_id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Secret "SG.<api_key_id>.<secret>", which is only returned on create
+	Key string `json:"-"`
+}
+
+// API key file loaded from SENDGRID_DEV_API_KEYS_FILE
+type keyFile struct {
+	Name   string   `json:"name"`
+	APIKey string   `json:"api_key"`
+	Scopes []string `json:"scopes"`
+}
+
+// Scopes of the endpoints of this server
+var Scopes = newScopes()
+
+type Store struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// Default store used by the API and the authorization
+var Default = NewStore()
+
+func NewStore() *Store {
+	return &Store{keys: map[string]*APIKey{}}
+}
+
+// Create API key with a new secret. Keys without scopes have full access.
+func (s *Store) Create(name string, scopes []string) APIKey {
+	id := newRandom(16)
+	return s.Add(APIKey{ID: id, Name: name, Scopes: scopes, Key: "SG." + id + "." + newRandom(32)})
+}
+
+// Add API key with its secret. ID is set when empty.
+func (s *Store) Add(key APIKey) APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.ID == "" {
+		key.ID = newRandom(16)
+	}
+	if len(key.Scopes) == 0 {
+		key.Scopes = Scopes
+	}
+	key.Scopes = append([]string{}, key.Scopes...)
+	s.keys[key.ID] = &key
+	return copyKey(&key)
+}
+
+// Get all API keys with their secrets
+func (s *Store) Snapshot() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range s.keys {
+		k := copyKey(key)
+		k.Key = key.Key
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Replace all API keys
+func (s *Store) Restore(keys []APIKey) {
+	s.mu.Lock()
+	s.keys = map[string]*APIKey{}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		s.Add(key)
+	}
+}
+
+// Get API key by ID
+func (s *Store) Get(id string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, false
+	}
+	return copyKey(key), true
+}
+
+// Find API key by secret
+func (s *Store) Find(secret string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.Key == secret {
+			return copyKey(key), true
+		}
+	}
+	return APIKey{}, false
+}
+
+// List API keys by name
+func (s *Store) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range s.keys {
+		keys = append(keys, copyKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Update name and scopes of API key. Scopes are kept when nil.
+func (s *Store) Update(id string, name string, scopes []string) (APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, false
+	}
+	key.Name = name
+	if scopes != nil {
+		key.Scopes = append([]string{}, scopes...)
+	}
+	return copyKey(key), true
+}
+
+// Delete API key
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return false
+	}
+	delete(s.keys, id)
+	return true
+}
+
+// Load API keys from JSON file, e.g. [{"name": "Mail", "api_key": "SG.mail", "scopes": ["mail.send"]}]
+func (s *Store) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var files []keyFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, file := range files {
+		if file.APIKey == "" {
+			return fmt.Errorf("%s: api_key is required", path)
+		}
+		if scope, ok := InvalidScope(file.Scopes); !ok {
+			return fmt.Errorf("%s: invalid scope %q", path, scope)
+		}
+		if _, ok := s.Find(file.APIKey); ok {
+			// Already loaded from the data directory
+			continue
+		}
+		s.Add(APIKey{Name: file.Name, Scopes: file.Scopes, Key: file.APIKey})
+	}
+	return nil
+}
+
+// Check if key has scope
+func (key APIKey) HasScope(scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the first scope which is not a scope of this server
+func InvalidScope(scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if !(APIKey{Scopes: Scopes}).HasScope(scope) {
+			return scope, false
+		}
+	}
+	return "", true
+}
+
+func newScopes() []string {
+	scopes := []string{
+		"mail.send",
+		"mail.batch.create", "mail.batch.read",
+		"user.scheduled_sends.create", "user.scheduled_sends.read", "user.scheduled_sends.update", "user.scheduled_sends.delete",
+		"user.webhooks.event.settings.read", "user.webhooks.event.settings.update",
+		"templates.create", "templates.read", "templates.update", "templates.delete",
+		"templates.versions.create", "templates.versions.read", "templates.versions.update", "templates.versions.delete",
+		"templates.versions.activate.create",
+		"asm.groups.create", "asm.groups.read", "asm.groups.update", "asm.groups.delete",
+		"asm.groups.suppressions.create", "asm.groups.suppressions.read", "asm.groups.suppressions.delete",
+		"asm.suppressions.global.create", "asm.suppressions.global.read", "asm.suppressions.global.delete",
+		"api_keys.create", "api_keys.read", "api_keys.update", "api_keys.delete",
+		"subusers.create", "subusers.read", "subusers.update", "subusers.delete",
+		"messages.read",
+		"stats.read", "categories.stats.read", "categories.stats.sums.read", "mailbox_providers.stats.read", "geo.stats.read",
+	}
+	for _, list := range suppression.Lists {
+		scopes = append(scopes, "suppression."+list+".create", "suppression."+list+".read", "suppression."+list+".delete")
+	}
+	return scopes
+}
+
+func copyKey(key *APIKey) APIKey {
+	k := *key
+	k.Scopes = append([]string{}, key.Scopes...)
+	return k
+}
+
+func newRandom(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
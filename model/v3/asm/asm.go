@@ -0,0 +1,302 @@
+package asm
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/v3/tracking"
+)
+
+type Group struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	IsDefault    bool   `json:"is_default"`
+	Unsubscribes int    `json:"unsubscribes"`
+}
+
+// Token of the unsubscribe and preferences URLs in a message
+type Token struct {
+	Email     string `json:"e"`
+	GroupID   int    `json:"g"`
+	Groups    []int  `json:"d,omitempty"`
+	MessageID string `json:"m"`
+	Subuser   string `json:"s,omitempty"`
+}
+
+type Store struct {
+	mu           sync.RWMutex
+	nextID       int
+	groups       map[int]*Group
+	suppressions map[int]map[string]int64
+}
+
+// Default store used by the API and mail/send
+var Default = NewStore()
+
+// Stores of the parent account and the subusers
+type Registry struct {
+	mu       sync.Mutex
+	parent   *Store
+	subusers map[string]*Store
+}
+
+// Default registry of Default and the stores of subusers
+var DefaultRegistry = NewRegistry(Default)
+
+func NewRegistry(parent *Store) *Registry {
+	return &Registry{parent: parent, subusers: map[string]*Store{}}
+}
+
+// Get store of subuser. The parent account ("") uses the parent store.
+func (r *Registry) For(subuser string) *Store {
+	if subuser == "" {
+		return r.parent
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	store, ok := r.subusers[subuser]
+	if !ok {
+		store = NewStore()
+		r.subusers[subuser] = store
+	}
+	return store
+}
+
+// Delete store of subuser
+func (r *Registry) DeleteFor(subuser string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subusers, subuser)
+}
+
+// Groups and their suppressions of a store
+type StoreSnapshot struct {
+	Groups       []Group                  `json:"groups"`
+	Suppressions map[int]map[string]int64 `json:"suppressions"`
+}
+
+// Get groups of the parent account ("") and every subuser
+func (r *Registry) Snapshot() map[string]StoreSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := map[string]StoreSnapshot{"": r.parent.snapshot()}
+	for subuser, store := range r.subusers {
+		snapshot[subuser] = store.snapshot()
+	}
+	return snapshot
+}
+
+// Replace groups of the parent account and the subusers
+func (r *Registry) Restore(snapshot map[string]StoreSnapshot) {
+	for subuser, storeSnapshot := range snapshot {
+		store := r.For(subuser)
+		store.mu.Lock()
+		store.nextID = 1
+		store.groups = map[int]*Group{}
+		store.suppressions = map[int]map[string]int64{}
+		for i := range storeSnapshot.Groups {
+			group := storeSnapshot.Groups[i]
+			store.groups[group.ID] = &group
+			store.suppressions[group.ID] = map[string]int64{}
+			for email, created := range storeSnapshot.Suppressions[group.ID] {
+				store.suppressions[group.ID][email] = created
+			}
+			if group.ID >= store.nextID {
+				store.nextID = group.ID + 1
+			}
+		}
+		store.mu.Unlock()
+	}
+}
+
+func NewStore() *Store {
+	return &Store{
+		nextID:       1,
+		groups:       map[int]*Group{},
+		suppressions: map[int]map[string]int64{},
+	}
+}
+
+func (s *Store) snapshot() StoreSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := StoreSnapshot{Groups: []Group{}, Suppressions: map[int]map[string]int64{}}
+	for id, group := range s.groups {
+		snapshot.Groups = append(snapshot.Groups, *group)
+		snapshot.Suppressions[id] = map[string]int64{}
+		for email, created := range s.suppressions[id] {
+			snapshot.Suppressions[id][email] = created
+		}
+	}
+	sort.Slice(snapshot.Groups, func(i, j int) bool {
+		return snapshot.Groups[i].ID < snapshot.Groups[j].ID
+	})
+	return snapshot
+}
+
+// Create group. Only one group can be the default group.
+func (s *Store) Create(group Group) Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group.ID = s.nextID
+	group.Unsubscribes = 0
+	s.nextID++
+	s.groups[group.ID] = &group
+	s.suppressions[group.ID] = map[string]int64{}
+	if group.IsDefault {
+		s.setDefault(group.ID)
+	}
+	return group
+}
+
+// Get group by ID
+func (s *Store) Get(id int) (Group, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return Group{}, false
+	}
+	return s.withUnsubscribes(group), true
+}
+
+// List groups by ID
+func (s *Store) List() []Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := []Group{}
+	for _, group := range s.groups {
+		groups = append(groups, s.withUnsubscribes(group))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+// Update name, description and is_default of group
+func (s *Store) Update(id int, update func(group *Group)) (Group, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return Group{}, false
+	}
+	update(group)
+	group.ID = id
+	if group.IsDefault {
+		s.setDefault(id)
+	}
+	return s.withUnsubscribes(group), true
+}
+
+// Delete group and its suppressions
+func (s *Store) Delete(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[id]; !ok {
+		return false
+	}
+	delete(s.groups, id)
+	delete(s.suppressions, id)
+	return true
+}
+
+// Add emails to the suppressions of group
+func (s *Store) AddSuppressions(id int, emails []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[id]; !ok {
+		return false
+	}
+	for _, email := range emails {
+		s.suppressions[id][normalize(email)] = time.Now().Unix()
+	}
+	return true
+}
+
+// Get suppressed emails of group
+func (s *Store) Suppressions(id int) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[id]; !ok {
+		return nil, false
+	}
+	emails := []string{}
+	for email := range s.suppressions[id] {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	return emails, true
+}
+
+// Delete email from the suppressions of group
+func (s *Store) DeleteSuppression(id int, email string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = normalize(email)
+	if _, ok := s.suppressions[id][email]; !ok {
+		return false
+	}
+	delete(s.suppressions[id], email)
+	return true
+}
+
+// Check if email is suppressed in group
+func (s *Store) IsSuppressed(id int, email string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.suppressions[id][normalize(email)]
+	return ok
+}
+
+func (s *Store) setDefault(id int) {
+	for _, group := range s.groups {
+		group.IsDefault = group.ID == id
+	}
+}
+
+func (s *Store) withUnsubscribes(group *Group) Group {
+	g := *group
+	g.Unsubscribes = len(s.suppressions[group.ID])
+	return g
+}
+
+// Encode token for URL, signed with key
+func (token Token) Encode(key []byte) string {
+	data, _ := json.Marshal(token)
+	return tracking.Sign(key, data)
+}
+
+// Decode token from URL. Tokens which were not signed with key are rejected.
+func ParseToken(s string, key []byte) (Token, error) {
+	var token Token
+	data, err := tracking.Verify(key, s)
+	if err != nil {
+		return token, err
+	}
+	err = json.Unmarshal(data, &token)
+	return token, err
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
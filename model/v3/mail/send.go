@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/smtp"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/jordan-wright/email"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/schedule"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -31,8 +36,12 @@ type PostRequest struct {
 			Email string `json:"email"`
 			Name  string `json:"name"`
 		} `json:"bcc"`
-		Substitutions map[string]string `json:"substitutions"`
-		Subject       string            `json:"subject"`
+		Substitutions       map[string]string      `json:"substitutions"`
+		DynamicTemplateData map[string]interface{} `json:"dynamic_template_data"`
+		Subject             string                 `json:"subject"`
+		Headers             map[string]string      `json:"headers"`
+		CustomArgs          map[string]string      `json:"custom_args"`
+		SendAt              int64                  `json:"send_at"`
 	} `json:"personalizations" validate:"required"`
 	From struct {
 		Email string `json:"email" validate:"required"`
@@ -42,11 +51,13 @@ type PostRequest struct {
 		Email string `json:"email"`
 		Name  string `json:"name"`
 	} `json:"reply_to"`
-	Subject string `json:"subject"`
-	Content []struct {
+	ReplyToList []emailAddress `json:"reply_to_list"`
+	Subject     string         `json:"subject"`
+	Content     []struct {
 		Type  string `json:"type"`
 		Value string `json:"value"`
-	} `json:"content" validate:"required"`
+	} `json:"content" validate:"required_without=TemplateId"`
+	TemplateId  string `json:"template_id"`
 	Attachments []struct {
 		Content     string `json:"content"`
 		Type        string `json:"type"`
@@ -54,6 +65,75 @@ type PostRequest struct {
 		Disposition string `json:"disposition"`
 		ContentId   string `json:"content_id"`
 	} `json:"attachments"`
+	Headers          map[string]string `json:"headers"`
+	Sections         map[string]string `json:"sections"`
+	Categories       []string          `json:"categories"`
+	CustomArgs       map[string]string `json:"custom_args"`
+	SendAt           int64             `json:"send_at"`
+	BatchId          string            `json:"batch_id"`
+	TrackingSettings struct {
+		ClickTracking struct {
+			Enable     bool `json:"enable"`
+			EnableText bool `json:"enable_text"`
+		} `json:"click_tracking"`
+		OpenTracking struct {
+			Enable          bool   `json:"enable"`
+			SubstitutionTag string `json:"substitution_tag"`
+		} `json:"open_tracking"`
+		SubscriptionTracking struct {
+			Enable          bool   `json:"enable"`
+			Text            string `json:"text"`
+			Html            string `json:"html"`
+			SubstitutionTag string `json:"substitution_tag"`
+		} `json:"subscription_tracking"`
+		Ganalytics ganalytics `json:"ganalytics"`
+	} `json:"tracking_settings"`
+	MailSettings struct {
+		BypassListManagement        setting `json:"bypass_list_management"`
+		BypassSpamManagement        setting `json:"bypass_spam_management"`
+		BypassBounceManagement      setting `json:"bypass_bounce_management"`
+		BypassUnsubscribeManagement setting `json:"bypass_unsubscribe_management"`
+		Footer                      struct {
+			Enable bool   `json:"enable"`
+			Text   string `json:"text"`
+			Html   string `json:"html"`
+		} `json:"footer"`
+		SandboxMode setting `json:"sandbox_mode"`
+		// Deprecated by SendGrid. Validated but ignored.
+		SpamCheck struct {
+			Enable    bool   `json:"enable"`
+			Threshold int    `json:"threshold"`
+			PostToUrl string `json:"post_to_url"`
+		} `json:"spam_check"`
+	} `json:"mail_settings"`
+	Asm *struct {
+		GroupId         int   `json:"group_id"`
+		GroupsToDisplay []int `json:"groups_to_display"`
+	} `json:"asm"`
+	// X-Message-Id of the response, set by Validate
+	XMessageId string `json:"-"`
+	// Subuser of the on-behalf-of header, set by the handler
+	Subuser string `json:"-"`
+	// Original JSON of the request, set by SetPostRequest
+	Raw json.RawMessage `json:"-"`
+	// Instance to send with, set by the handler. instance.Default when nil.
+	Instance *instance.Instance `json:"-"`
+}
+
+// Same type as the addresses of PostRequest
+type emailAddress = struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// Setting which is only enabled or disabled
+type setting struct {
+	Enable bool `json:"enable"`
+}
+
+type droppedRecipient struct {
+	Email  string
+	Reason string
 }
 
 type ErrorResponse struct {
@@ -65,47 +145,82 @@ type ErrorResponse struct {
 }
 
 func (postRequest *PostRequest) SetPostRequest(requestBody io.ReadCloser) error {
-	return json.NewDecoder(requestBody).Decode(&postRequest)
+	raw, err := io.ReadAll(requestBody)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &postRequest); err != nil {
+		return err
+	}
+	postRequest.Raw = raw
+	return nil
 }
 
 func (postRequest *PostRequest) Validate() (int, ErrorResponse) {
+	if postRequest.size() > maxMessageSize {
+		return http.StatusRequestEntityTooLarge,
+			GetErrorResponse(
+				"The total size of your email, including attachments, must be less than 30MB.",
+				nil,
+				helpURL+"#message.size",
+			)
+	}
+
+	errorResponse := ErrorResponse{}
 	validate := validator.New()
 	if err := validate.Struct(postRequest); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			switch err.ActualTag() {
-			case "required":
+			case "required", "required_without":
 				switch err.StructField() {
 				case "Personalizations":
-					return http.StatusBadRequest,
-						GetErrorResponse(
-							"The personalizations field is required and must have at least one personalization.",
-							"personalizations",
-							"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#-Personalizations-Errors",
-						)
+					errorResponse.Add(
+						"The personalizations field is required and must have at least one personalization.",
+						"personalizations",
+						helpURL+"#-Personalizations-Errors",
+					)
 				case "Email":
-					return http.StatusBadRequest,
-						GetErrorResponse(
-							"The from object must be provided for every email send. It is an object that requires the email parameter, but may also contain a name parameter.  e.g. {\"email\" : \"example@example.com\"}  or {\"email\" : \"example@example.com\", \"name\" : \"Example Recipient\"}.",
-							"from.email",
-							"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.from",
-						)
+					errorResponse.Add(
+						"The from object must be provided for every email send. It is an object that requires the email parameter, but may also contain a name parameter.  e.g. {\"email\" : \"example@example.com\"}  or {\"email\" : \"example@example.com\", \"name\" : \"Example Recipient\"}.",
+						"from.email",
+						helpURL+"#message.from",
+					)
 				case "Content":
-					return http.StatusBadRequest,
-						GetErrorResponse(
-							"Unless a valid template_id is provided, the content parameter is required. There must be at least one defined content block. We typically suggest both text/plain and text/html blocks are included, but only one block is required.",
-							"content",
-							"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.content",
-						)
+					errorResponse.Add(
+						"Unless a valid template_id is provided, the content parameter is required. There must be at least one defined content block. We typically suggest both text/plain and text/html blocks are included, but only one block is required.",
+						"content",
+						helpURL+"#message.content",
+					)
 				}
 			}
 		}
 	}
 
+	for _, rule := range rules {
+		rule(postRequest, &errorResponse)
+	}
+	if len(errorResponse.Errors) > 0 {
+		return http.StatusBadRequest, errorResponse
+	}
+
+	// Sandbox mode validates the request without delivering like SendGrid
+	if postRequest.MailSettings.SandboxMode.Enable {
+		return http.StatusOK, ErrorResponse{}
+	}
+
+	postRequest.XMessageId = messages.NewXMessageID()
 	return sendMailWithSMTP(*postRequest)
 }
 
 func GetErrorResponse(message string, field interface{}, help interface{}) ErrorResponse {
 	errorJSON := ErrorResponse{}
+	errorJSON.Add(message, field, help)
+
+	return errorJSON
+}
+
+// Add error to the response
+func (errorResponse *ErrorResponse) Add(message string, field interface{}, help interface{}) {
 	e := struct {
 		Message string      `json:"message"`
 		Field   interface{} `json:"field"`
@@ -115,57 +230,131 @@ func GetErrorResponse(message string, field interface{}, help interface{}) Error
 		field,
 		help,
 	}
-	errorJSON.Errors = append(errorJSON.Errors, e)
+	errorResponse.Errors = append(errorResponse.Errors, e)
+}
 
-	return errorJSON
+// Get instance to send with
+func (postRequest *PostRequest) getInstance() *instance.Instance {
+	if postRequest.Instance == nil {
+		return instance.Default
+	}
+	return postRequest.Instance
 }
 
 // Send mail with SMTP
 func sendMailWithSMTP(postRequest PostRequest) (int, ErrorResponse) {
-	for _, personalizations := range postRequest.Personalizations {
+	inst := postRequest.getInstance()
+	transport, err := GetTransport(inst.Getenv)
+	if err != nil {
+		return http.StatusInternalServerError, GetErrorResponse(err.Error(), nil, nil)
+	}
+
+	template, version, hasTemplate := inst.Templates.For(postRequest.Subuser).Active(postRequest.TemplateId)
+
+	// Every personalization is rendered before the first one is sent, so that a 400 response sends nothing
+	var jobs []schedule.Job
+	for index, personalizations := range postRequest.Personalizations {
 		e := email.NewEmail()
+		id := messages.NewID(postRequest.XMessageId, index)
 
 		e.From = postRequest.From.Name + " <" + postRequest.From.Email + ">"
 
-		for _, to := range personalizations.To {
+		to, dropped := filterSuppressed(personalizations.To, postRequest, nil)
+		cc, dropped := filterSuppressed(personalizations.Cc, postRequest, dropped)
+		bcc, dropped := filterSuppressed(personalizations.Bcc, postRequest, dropped)
+
+		for _, to := range to {
 			e.To = append(e.To, getEmailwithName(to))
 		}
 
-		for _, cc := range personalizations.Cc {
+		for _, cc := range cc {
 			e.Cc = append(e.Cc, getEmailwithName(cc))
 		}
 
-		for _, bcc := range personalizations.Bcc {
+		for _, bcc := range bcc {
 			e.Bcc = append(e.Bcc, getEmailwithName(bcc))
 		}
 
-		replacements := make([]string, len(personalizations.Substitutions)*2)
-		for key, value := range personalizations.Substitutions {
-			replacements = append(replacements, key, value)
+		// Links in the message are for the first recipient
+		recipient := ""
+		if recipients := append(append(append([]emailAddress{}, to...), cc...), bcc...); len(recipients) > 0 {
+			recipient = recipients[0].Email
 		}
-		replacer := strings.NewReplacer(replacements...)
 
-		if personalizations.Subject != "" {
-			e.Subject = replacer.Replace(personalizations.Subject)
-		} else if postRequest.Subject != "" {
-			e.Subject = replacer.Replace(postRequest.Subject)
-		} else {
-			return http.StatusBadRequest,
-				GetErrorResponse(
-					"The subject is required. You can get around this requirement if you use a template with a subject defined or if every personalization has a subject defined.",
-					"subject",
-					"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.subject",
-				)
+		var replacements []string
+		if postRequest.Asm != nil && recipient != "" {
+			replacements = getASMReplacements(id, recipient, postRequest)
+		}
+		// Dynamic templates are rendered with Handlebars only, the ASM tags are still replaced
+		replacer := newSubstituter(postRequest.Sections, personalizations.Substitutions, replacements...)
+		if hasTemplate && template.Generation == templates.GenerationDynamic {
+			replacer = newSubstituter(nil, nil, replacements...)
+		}
+
+		subject := personalizations.Subject
+		if subject == "" {
+			subject = postRequest.Subject
 		}
 
+		html, text := "", ""
 		for _, content := range postRequest.Content {
 			if content.Type == "text/html" {
-				e.HTML = []byte(replacer.Replace((content.Value)))
+				html = content.Value
 			} else {
-				e.Text = []byte(replacer.Replace((content.Value)))
+				text = content.Value
+			}
+		}
+
+		if hasTemplate {
+			switch template.Generation {
+			case templates.GenerationDynamic:
+				templateSubject, templateHTML, templateText, err := version.Render(personalizations.DynamicTemplateData)
+				if err != nil {
+					return http.StatusBadRequest,
+						GetErrorResponse(
+							"The template could not be rendered: "+err.Error(),
+							"template_id",
+							"http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html#message.template_id",
+						)
+				}
+				if templateSubject != "" {
+					subject = templateSubject
+				}
+				if templateHTML != "" {
+					html = templateHTML
+				}
+				if templateText != "" {
+					text = templateText
+				}
+			default:
+				// Legacy templates wrap the request subject and content
+				if version.Subject != "" {
+					subject = strings.ReplaceAll(version.Subject, "<%subject%>", subject)
+				}
+				if version.HTMLContent != "" {
+					html = strings.ReplaceAll(version.HTMLContent, "<%body%>", html)
+				}
+				if version.PlainContent != "" {
+					text = strings.ReplaceAll(version.PlainContent, "<%body%>", text)
+				}
 			}
 		}
 
+		if footer := postRequest.MailSettings.Footer; footer.Enable {
+			html = addFooter(html, footer.Html, "</body>")
+			text = addFooter(text, footer.Text, "")
+		}
+
+		e.Subject = replacer.Replace(subject)
+
+		html, text = applyTrackingSettings(id, recipient, postRequest, replacer.Replace(html), replacer.Replace(text))
+		if html != "" {
+			e.HTML = []byte(html)
+		}
+		if text != "" {
+			e.Text = []byte(text)
+		}
+
 		i := 0
 		for _, attachment := range postRequest.Attachments {
 			dirName := createAttachment(attachment.Filename, attachment.Content, i)
@@ -181,36 +370,229 @@ func sendMailWithSMTP(postRequest PostRequest) (int, ErrorResponse) {
 			i++
 		}
 
-		if os.Getenv("SENDGRID_DEV_TEST") == "1" {
-			continue
+		// Personalization headers and custom_args override the ones of the request
+		headers := mergeMaps(postRequest.Headers, personalizations.Headers)
+		for name, value := range headers {
+			headers[name] = replacer.Replace(value)
+			e.Headers.Set(name, headers[name])
+		}
+		customArgs := mergeMaps(postRequest.CustomArgs, personalizations.CustomArgs)
+		if smtpAPI := getSMTPAPIHeader(postRequest.Categories, customArgs); smtpAPI != "" {
+			e.Headers.Set("X-SMTPAPI", smtpAPI)
 		}
 
-		if len(os.Getenv("SENDGRID_DEV_SMTP_USERNAME")) > 0 {
-			arr := strings.Split(os.Getenv("SENDGRID_DEV_SMTP_SERVER"), ":")
-			e.Send(
-				os.Getenv("SENDGRID_DEV_SMTP_SERVER"),
-				smtp.PlainAuth(
-					"",
-					os.Getenv("SENDGRID_DEV_SMTP_USERNAME"),
-					os.Getenv("SENDGRID_DEV_SMTP_PASSWORD"),
-					arr[0],
-				),
-			)
+		message := newMessage(id, postRequest, to, cc, bcc, e)
+		message.Headers = headers
+		message.CustomArgs = customArgs
+		message.Substitutions = personalizations.Substitutions
+		message.DynamicTemplateData = personalizations.DynamicTemplateData
+		asmGroupID := 0
+		if postRequest.Asm != nil {
+			asmGroupID = postRequest.Asm.GroupId
+		}
+		send := func() {
+			for _, d := range dropped {
+				inst.Dispatcher.Publish(webhook.NewEvent("dropped", message, d.Email, map[string]interface{}{"reason": d.Reason}))
+			}
+			// Delivered recipients are recorded first, so /v3/messages/{msg_id} shows one of them
+			defer func() {
+				for _, d := range dropped {
+					inst.Activity.Add(message, d.Email, postRequest.TemplateId, asmGroupID)
+				}
+			}()
+			if len(to)+len(cc)+len(bcc) == 0 {
+				return
+			}
+			message := inst.Messages.Add(message)
+			for _, addresses := range [][]emailAddress{to, cc, bcc} {
+				for _, address := range addresses {
+					inst.Activity.Add(message, address.Email, postRequest.TemplateId, asmGroupID)
+				}
+			}
+
+			if err := transport.Send(message); err != nil {
+				fmt.Println("Send mail failed.", message.ID, err)
+			}
+
+			inst.Dispatcher.PublishAccepted(message)
 		}
 
-		e.Send(os.Getenv("SENDGRID_DEV_SMTP_SERVER"), nil)
+		// Personalization send_at overrides the one of the request
+		sendAt := personalizations.SendAt
+		if sendAt == 0 {
+			sendAt = postRequest.SendAt
+		}
+		jobs = append(jobs, schedule.Job{BatchID: postRequest.BatchId, SendAt: sendAt, Send: send})
+	}
+
+	for _, job := range jobs {
+		if job.SendAt > inst.Scheduler.Now().Unix() || job.BatchID != "" {
+			inst.Scheduler.Schedule(job)
+		} else {
+			job.Send()
+		}
 	}
 	return http.StatusAccepted, GetErrorResponse("", nil, nil)
 }
 
 // Get "Name <name@example.com>"
-func getEmailwithName(t struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
-}) string {
+func getEmailwithName(t emailAddress) string {
 	return t.Name + " <" + t.Email + ">"
 }
 
+// Remove suppressed recipients (bounces, spam reports, invalid emails, unsubscribes and the unsubscribe group).
+// bypass_*_management of mail_settings skip the lists.
+func filterSuppressed(addresses []emailAddress, postRequest PostRequest, dropped []droppedRecipient) ([]emailAddress, []droppedRecipient) {
+	mailSettings := postRequest.MailSettings
+	if mailSettings.BypassListManagement.Enable {
+		return addresses, dropped
+	}
+
+	var bypass []string
+	if mailSettings.BypassSpamManagement.Enable {
+		bypass = append(bypass, suppression.SpamReports)
+	}
+	if mailSettings.BypassBounceManagement.Enable {
+		bypass = append(bypass, suppression.Bounces)
+	}
+	if mailSettings.BypassUnsubscribeManagement.Enable {
+		// Group unsubscribes are not bypassed
+		bypass = append(bypass, suppression.Unsubscribes)
+	}
+	groupID := 0
+	if postRequest.Asm != nil {
+		groupID = postRequest.Asm.GroupId
+	}
+
+	var filtered []emailAddress
+	for _, address := range addresses {
+		if reason, ok := postRequest.getInstance().Suppressions.For(postRequest.Subuser).DropReason(address.Email, bypass...); ok {
+			dropped = append(dropped, droppedRecipient{address.Email, reason})
+			continue
+		}
+		if groupID > 0 && postRequest.getInstance().Groups.For(postRequest.Subuser).IsSuppressed(groupID, address.Email) {
+			dropped = append(dropped, droppedRecipient{address.Email, "Unsubscribed Address"})
+			continue
+		}
+		filtered = append(filtered, address)
+	}
+	return filtered, dropped
+}
+
+// Add footer to content. The footer is inserted before the closing tag when content has it.
+func addFooter(content string, footer string, closingTag string) string {
+	if content == "" || footer == "" {
+		return content
+	}
+	if closingTag != "" {
+		if i := strings.LastIndex(content, closingTag); i >= 0 {
+			return content[:i] + footer + content[i:]
+		}
+	}
+	return content + footer
+}
+
+// Get X-SMTPAPI header with categories and custom_args (unique_args) like SendGrid SMTP API
+func getSMTPAPIHeader(categories []string, customArgs map[string]string) string {
+	if len(categories) == 0 && len(customArgs) == 0 {
+		return ""
+	}
+
+	smtpAPI := struct {
+		Category   []string          `json:"category,omitempty"`
+		UniqueArgs map[string]string `json:"unique_args,omitempty"`
+	}{categories, customArgs}
+	data, _ := json.Marshal(smtpAPI)
+	return string(data)
+}
+
+// Merge maps. Values of override win.
+func mergeMaps(base map[string]string, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+
+	merged := map[string]string{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Get replacements of the ASM substitution tags with local URLs
+func getASMReplacements(id string, recipient string, postRequest PostRequest) []string {
+	token := asm.Token{Email: recipient, GroupID: postRequest.Asm.GroupId, Groups: postRequest.Asm.GroupsToDisplay, MessageID: id, Subuser: postRequest.Subuser}
+	globalToken := token
+	globalToken.GroupID = 0
+	publicURL := GetPublicURL(postRequest.getInstance().Getenv)
+	key := postRequest.getInstance().TokenKey()
+
+	return []string{
+		"<%asm_group_unsubscribe_raw_url%>", publicURL + "/dev/asm/unsubscribe?token=" + token.Encode(key),
+		"<%asm_global_unsubscribe_raw_url%>", publicURL + "/dev/asm/unsubscribe?token=" + globalToken.Encode(key),
+		"<%asm_preferences_raw_url%>", publicURL + "/dev/asm/preferences?token=" + token.Encode(key),
+	}
+}
+
+// Get URL of this server for links in messages.
+// SENDGRID_DEV_PUBLIC_URL or "http://localhost" with the port of SENDGRID_DEV_API_SERVER.
+func GetPublicURL(getenv func(key string) string) string {
+	if getenv("SENDGRID_DEV_PUBLIC_URL") != "" {
+		return strings.TrimSuffix(getenv("SENDGRID_DEV_PUBLIC_URL"), "/")
+	}
+	if strings.HasPrefix(getenv("SENDGRID_DEV_API_SERVER"), ":") {
+		return "http://localhost" + getenv("SENDGRID_DEV_API_SERVER")
+	}
+	if getenv("SENDGRID_DEV_API_SERVER") == "" {
+		return "http://localhost:3030"
+	}
+	return "http://" + getenv("SENDGRID_DEV_API_SERVER")
+}
+
+// Create message for the message store and events
+func newMessage(id string, postRequest PostRequest, to, cc, bcc []emailAddress, e *email.Email) messages.Message {
+	// Fix Message-Id so that every transport sends the same MIME message
+	smtpID := "<" + id + "@sendgrid-dev>"
+	e.Headers.Set("Message-Id", smtpID)
+	e.Headers.Set("X-Message-Id", postRequest.XMessageId)
+	e.Headers.Set("X-SG-Message-Id", id)
+	raw, err := e.Bytes()
+	if err != nil {
+		fmt.Println("Create MIME message failed.", err)
+	}
+
+	message := messages.Message{
+		ID:         id,
+		XMessageID: postRequest.XMessageId,
+		SMTPID:     smtpID,
+		From:       messages.Address{Email: postRequest.From.Email, Name: postRequest.From.Name},
+		Subject:    e.Subject,
+		Text:       string(e.Text),
+		HTML:       string(e.HTML),
+		Categories: postRequest.Categories,
+		Subuser:    postRequest.Subuser,
+		Request:    postRequest.Raw,
+		Raw:        raw,
+	}
+	if postRequest.ReplyTo.Email != "" {
+		message.ReplyTo = &messages.Address{Email: postRequest.ReplyTo.Email, Name: postRequest.ReplyTo.Name}
+	}
+	for _, address := range to {
+		message.To = append(message.To, messages.Address(address))
+	}
+	for _, address := range cc {
+		message.Cc = append(message.Cc, messages.Address(address))
+	}
+	for _, address := range bcc {
+		message.Bcc = append(message.Bcc, messages.Address(address))
+	}
+
+	return message
+}
+
 // Create attachment from base64 string
 func createAttachment(fileName string, base64Content string, i int) string {
 	data, err := base64.StdEncoding.DecodeString(base64Content)
@@ -218,8 +600,11 @@ func createAttachment(fileName string, base64Content string, i int) string {
 		return ""
 	}
 
-	dirName := filepath.Join(os.TempDir(), "attachment_"+strconv.FormatInt(time.Now().UnixNano(), 10))
-	os.Mkdir(dirName, 0777)
+	dirName, err := os.MkdirTemp("", "attachment_")
+	if err != nil {
+		fmt.Println("Create directory failed.", err)
+		return ""
+	}
 	file, err := os.Create(filepath.Join(dirName, fileName))
 	if err != nil {
 		fmt.Println("Create file failed.", fileName)
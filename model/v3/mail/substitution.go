@@ -0,0 +1,79 @@
+package send
+
+import (
+	"sort"
+	"strings"
+)
+
+// Size of content after which sections which refer to themselves are not expanded any more
+const maxExpandedSize = maxMessageSize
+
+// Substituter applies the legacy sections and substitutions of a personalization.
+// Tags are literal keys like "-name-" or "%name%", there is no substitution wrapper.
+type substituter struct {
+	sections      *strings.Replacer
+	substitutions *strings.Replacer
+	passes        int
+}
+
+// Create substituter. replacements are extra pairs of tag and value like the ASM URLs.
+// A substitution value which names a section is expanded here, and the substitutions are applied
+// once to the section content like SendGrid does for "-greeting-": "%morning%".
+func newSubstituter(sections map[string]string, substitutions map[string]string, replacements ...string) substituter {
+	s := substituter{
+		sections: strings.NewReplacer(pairs(sections)...),
+		// A chain of sections without a cycle is expanded within one pass per section
+		passes: len(sections) + 1,
+	}
+	raw := strings.NewReplacer(pairs(substitutions)...)
+	values := make(map[string]string, len(substitutions))
+	for tag, value := range substitutions {
+		if expanded := s.expand(value); expanded != value {
+			value = raw.Replace(expanded)
+		}
+		values[tag] = value
+	}
+	s.substitutions = strings.NewReplacer(append(pairs(values), replacements...)...)
+	return s
+}
+
+// Replace tags of content. Only sections are nested: they are expanded until the content stops changing,
+// then substitutions are applied once so that a value containing its own tag is not expanded again.
+func (s substituter) Replace(content string) string {
+	return s.substitutions.Replace(s.expand(content))
+}
+
+// Expand sections of content until it stops changing, or a cycle of sections makes it too large
+func (s substituter) expand(content string) string {
+	for i := 0; i < s.passes && len(content) <= maxExpandedSize; i++ {
+		expanded := s.sections.Replace(content)
+		if expanded == content {
+			break
+		}
+		content = expanded
+	}
+	return content
+}
+
+// Get pairs of tag and value for strings.NewReplacer.
+// Longer tags come first so that a tag is not replaced by a tag it contains.
+func pairs(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	pairs := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		pairs = append(pairs, key, m[key])
+	}
+	return pairs
+}
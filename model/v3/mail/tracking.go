@@ -0,0 +1,186 @@
+package send
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yKanazawa/sendgrid-dev/model/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/tracking"
+)
+
+const (
+	defaultSubscriptionText = "If you would like to unsubscribe and stop receiving these emails click here: <% %>."
+	defaultSubscriptionHTML = "<p>If you would like to unsubscribe and stop receiving these emails <% click here %>.</p>"
+)
+
+var (
+	hrefPattern     = regexp.MustCompile(`(?i)(href\s*=\s*)(?:"(https?://[^"]*)"|'(https?://[^']*)')`)
+	textLinkPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+	subscriptionTag = regexp.MustCompile(`<%\s*(.*?)\s*%>`)
+
+	// Substitution tags of the unsubscribe URL when subscription tracking has no substitution_tag
+	unsubscribeTags = []string{"[unsubscribe]", "[Unsubscribe]"}
+)
+
+// Google Analytics parameters of tracking_settings
+type ganalytics struct {
+	Enable      bool   `json:"enable"`
+	UtmSource   string `json:"utm_source"`
+	UtmMedium   string `json:"utm_medium"`
+	UtmTerm     string `json:"utm_term"`
+	UtmContent  string `json:"utm_content"`
+	UtmCampaign string `json:"utm_campaign"`
+}
+
+// Apply tracking_settings to content like SendGrid does on delivery.
+// Links are tagged with utm_* parameters, then rewritten to the local click tracking URL.
+// The unsubscribe link and the open tracking pixel are added last so that they are not tracked as clicks.
+func applyTrackingSettings(id string, recipient string, postRequest PostRequest, htmlContent string, textContent string) (string, string) {
+	settings := postRequest.TrackingSettings
+	publicURL := GetPublicURL(postRequest.getInstance().Getenv)
+	key := postRequest.getInstance().TokenKey()
+
+	if settings.Ganalytics.Enable {
+		htmlContent = rewriteHTMLLinks(htmlContent, publicURL, func(link string, index int) string {
+			return settings.Ganalytics.tag(link)
+		})
+		textContent = rewriteTextLinks(textContent, publicURL, func(link string, index int) string {
+			return settings.Ganalytics.tag(link)
+		})
+	}
+
+	if settings.ClickTracking.Enable {
+		htmlContent = rewriteHTMLLinks(htmlContent, publicURL, func(link string, index int) string {
+			return clickTrackingURL(publicURL, key, tracking.Token{Email: recipient, MessageID: id, URL: link, Index: index, Type: tracking.TypeHTML})
+		})
+		if settings.ClickTracking.EnableText {
+			textContent = rewriteTextLinks(textContent, publicURL, func(link string, index int) string {
+				return clickTrackingURL(publicURL, key, tracking.Token{Email: recipient, MessageID: id, URL: link, Index: index, Type: tracking.TypeText})
+			})
+		}
+	}
+
+	if subscription := settings.SubscriptionTracking; subscription.Enable {
+		unsubscribeURL := publicURL + "/dev/asm/unsubscribe?token=" + asm.Token{Email: recipient, MessageID: id, Subuser: postRequest.Subuser}.Encode(key)
+
+		tags := unsubscribeTags
+		if subscription.SubstitutionTag != "" {
+			tags = []string{subscription.SubstitutionTag}
+		}
+		replaced := false
+		for _, tag := range tags {
+			if strings.Contains(htmlContent, tag) || strings.Contains(textContent, tag) {
+				htmlContent = strings.ReplaceAll(htmlContent, tag, html.EscapeString(unsubscribeURL))
+				textContent = strings.ReplaceAll(textContent, tag, unsubscribeURL)
+				replaced = true
+			}
+		}
+
+		// The footer is added when content has no substitution tag. <% text %> is the link.
+		if !replaced {
+			footerHTML, footerText := subscription.Html, subscription.Text
+			if footerHTML == "" {
+				footerHTML = defaultSubscriptionHTML
+			}
+			if footerText == "" {
+				footerText = defaultSubscriptionText
+			}
+			footerHTML = subscriptionTag.ReplaceAllStringFunc(footerHTML, func(tag string) string {
+				return `<a href="` + html.EscapeString(unsubscribeURL) + `">` + subscriptionTag.FindStringSubmatch(tag)[1] + `</a>`
+			})
+			footerText = subscriptionTag.ReplaceAllLiteralString(footerText, unsubscribeURL)
+			htmlContent = addFooter(htmlContent, footerHTML, "</body>")
+			textContent = addFooter(textContent, "\n\n"+footerText, "")
+		}
+	}
+
+	if open := settings.OpenTracking; open.Enable && htmlContent != "" {
+		pixel := `<img src="` + html.EscapeString(publicURL+"/dev/track/open?token="+tracking.Token{Email: recipient, MessageID: id}.Encode(key)) + `" alt="" width="1" height="1" border="0" style="height:1px !important;width:1px !important;border-width:0 !important;margin:0 !important;padding:0 !important;"/>`
+		if open.SubstitutionTag != "" && strings.Contains(htmlContent, open.SubstitutionTag) {
+			htmlContent = strings.ReplaceAll(htmlContent, open.SubstitutionTag, pixel)
+		} else if i := strings.LastIndex(htmlContent, "</body>"); i >= 0 {
+			htmlContent = htmlContent[:i] + pixel + htmlContent[i:]
+		} else {
+			htmlContent += pixel
+		}
+	}
+
+	return htmlContent, textContent
+}
+
+// Rewrite href links of HTML content. rewrite gets the unescaped URL and the index of the link.
+// Links to this server (publicURL), e.g. the unsubscribe URLs, are kept.
+func rewriteHTMLLinks(content string, publicURL string, rewrite func(link string, index int) string) string {
+	index := 0
+	return hrefPattern.ReplaceAllStringFunc(content, func(match string) string {
+		submatches := hrefPattern.FindStringSubmatch(match)
+		link := html.UnescapeString(submatches[2] + submatches[3])
+		if isLocalURL(publicURL, link) {
+			return match
+		}
+		link = rewrite(link, index)
+		index++
+		return submatches[1] + `"` + html.EscapeString(link) + `"`
+	})
+}
+
+// Rewrite links of text content. rewrite gets the URL and the index of the link.
+func rewriteTextLinks(content string, publicURL string, rewrite func(link string, index int) string) string {
+	index := 0
+	return textLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		if isLocalURL(publicURL, link) {
+			return link
+		}
+		link = rewrite(link, index)
+		index++
+		return link
+	})
+}
+
+// Append utm_* parameters to the query of link. The query is kept as it is and its parameters are not overwritten.
+func (g ganalytics) tag(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	query := u.Query()
+	var tags []string
+	for _, parameter := range []struct{ key, value string }{
+		{"utm_source", g.UtmSource},
+		{"utm_medium", g.UtmMedium},
+		{"utm_term", g.UtmTerm},
+		{"utm_content", g.UtmContent},
+		{"utm_campaign", g.UtmCampaign},
+	} {
+		if parameter.value != "" && query.Get(parameter.key) == "" {
+			tags = append(tags, parameter.key+"="+url.QueryEscape(parameter.value))
+		}
+	}
+	if len(tags) == 0 {
+		return link
+	}
+
+	link, fragment, hasFragment := strings.Cut(link, "#")
+	switch {
+	case !strings.Contains(link, "?"):
+		link += "?"
+	case !strings.HasSuffix(link, "?") && !strings.HasSuffix(link, "&"):
+		link += "&"
+	}
+	link += strings.Join(tags, "&")
+	if hasFragment {
+		link += "#" + fragment
+	}
+	return link
+}
+
+func clickTrackingURL(publicURL string, key []byte, token tracking.Token) string {
+	return publicURL + "/dev/track/click?token=" + token.Encode(key)
+}
+
+func isLocalURL(publicURL string, link string) bool {
+	return strings.HasPrefix(link, publicURL+"/dev/")
+}
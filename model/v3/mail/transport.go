@@ -0,0 +1,207 @@
+package send
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+)
+
+// Transport delivers an accepted message.
+// Every transport sends message.Raw, the MIME message kept in the message store.
+type Transport interface {
+	Send(message messages.Message) error
+}
+
+// Deliver with SMTP (MailDev, MailTrap, ...)
+type SMTPTransport struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+func (t SMTPTransport) Send(message messages.Message) error {
+	var recipients []string
+	for _, addresses := range [][]messages.Address{message.To, message.Cc, message.Bcc} {
+		for _, address := range addresses {
+			recipients = append(recipients, address.Email)
+		}
+	}
+
+	var auth smtp.Auth
+	if t.Username != "" {
+		host := strings.Split(t.Addr, ":")[0]
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+	return smtp.SendMail(t.Addr, auth, message.From.Email, recipients, message.Raw)
+}
+
+// Discard messages
+type NoopTransport struct{}
+
+func (t NoopTransport) Send(message messages.Message) error {
+	return nil
+}
+
+// Keep messages only in the message store (/dev/messages), which every accepted message is added to
+type StoreTransport struct{}
+
+func (t StoreTransport) Send(message messages.Message) error {
+	return nil
+}
+
+// Write each message to "<Dir>/<id>.eml"
+type FileTransport struct {
+	Dir string
+}
+
+func (t FileTransport) Send(message messages.Message) error {
+	if err := os.MkdirAll(t.Dir, 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.Dir, message.ID+".eml"), message.Raw, 0666)
+}
+
+// Write each message to the "new" directory of a Maildir
+type MaildirTransport struct {
+	Dir string
+}
+
+func (t MaildirTransport) Send(message messages.Message) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0777); err != nil {
+			return err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + message.ID + "." + hostname
+	tmp := filepath.Join(t.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, message.Raw, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.Dir, "new", name))
+}
+
+// Print each message to Writer (os.Stdout by default)
+type StdoutTransport struct {
+	Writer io.Writer
+}
+
+func (t StdoutTransport) Send(message messages.Message) error {
+	w := t.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err := fmt.Fprintf(w, "----- %s -----\n%s\n", message.ID, message.Raw)
+	return err
+}
+
+// POST each message as "message/rfc822" to URL
+type HTTPTransport struct {
+	URL    string
+	Client *http.Client
+}
+
+func (t HTTPTransport) Send(message messages.Message) error {
+	request, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(message.Raw))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "message/rfc822")
+	request.Header.Set("X-Sendgrid-Dev-Message-Id", message.ID)
+
+	client := t.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", t.URL, response.Status)
+	}
+	return nil
+}
+
+// Fan-out to every transport
+type MultiTransport []Transport
+
+func (t MultiTransport) Send(message messages.Message) error {
+	var errs []error
+	for _, transport := range t {
+		if err := transport.Send(message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Get transport by names, separated by commas (e.g. "smtp,file"). getenv gets the settings of the transports.
+func NewTransport(names string, getenv func(key string) string) (Transport, error) {
+	var transports MultiTransport
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "smtp":
+			transports = append(transports, SMTPTransport{
+				Addr:     getenv("SENDGRID_DEV_SMTP_SERVER"),
+				Username: getenv("SENDGRID_DEV_SMTP_USERNAME"),
+				Password: getenv("SENDGRID_DEV_SMTP_PASSWORD"),
+			})
+		case "noop", "":
+			transports = append(transports, NoopTransport{})
+		case "store":
+			transports = append(transports, StoreTransport{})
+		case "file":
+			transports = append(transports, FileTransport{Dir: getDir(getenv("SENDGRID_DEV_FILE_DIR"), "sendgrid-dev")})
+		case "maildir":
+			transports = append(transports, MaildirTransport{Dir: getDir(getenv("SENDGRID_DEV_MAILDIR"), "sendgrid-dev-maildir")})
+		case "stdout":
+			transports = append(transports, StdoutTransport{})
+		case "http":
+			if getenv("SENDGRID_DEV_HTTP_FORWARD_URL") == "" {
+				return nil, errors.New("SENDGRID_DEV_HTTP_FORWARD_URL is required for http transport")
+			}
+			transports = append(transports, HTTPTransport{URL: getenv("SENDGRID_DEV_HTTP_FORWARD_URL")})
+		default:
+			return nil, fmt.Errorf("unknown transport %q", name)
+		}
+	}
+
+	if len(transports) == 1 {
+		return transports[0], nil
+	}
+	return transports, nil
+}
+
+// Get transport from SENDGRID_DEV_TRANSPORT ("smtp" by default).
+// SENDGRID_DEV_TEST=1 always discards messages.
+func GetTransport(getenv func(key string) string) (Transport, error) {
+	if getenv("SENDGRID_DEV_TEST") == "1" {
+		return NoopTransport{}, nil
+	}
+	if getenv("SENDGRID_DEV_TRANSPORT") == "" {
+		return NewTransport("smtp", getenv)
+	}
+	return NewTransport(getenv("SENDGRID_DEV_TRANSPORT"), getenv)
+}
+
+// Get dir, or defaultName in the temporary directory when dir is empty
+func getDir(dir string, defaultName string) string {
+	if dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), defaultName)
+}
@@ -0,0 +1,534 @@
+package send
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/v3/templates"
+)
+
+const (
+	helpURL = "http://sendgrid.com/docs/API_Reference/Web_API_v3/Mail/errors.html"
+
+	maxPersonalizations = 1000
+	maxRecipients       = 1000
+	maxReplyToList      = 1000
+	maxCategories       = 10
+	maxCategoryLength   = 255
+	maxCustomArgsSize   = 10000
+	maxSubstitutionSize = 10000
+	maxMessageSize      = 30 * 1024 * 1024
+	maxScheduleAhead    = 72 * time.Hour
+)
+
+var (
+	emailPattern      = regexp.MustCompile(`^[^@\s<>(),;:"]+@[^@\s<>(),;:"]+\.[^@\s<>(),;:"]+$`)
+	headerNamePattern = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+	urlPattern        = regexp.MustCompile(`^https?://[^\s]+$`)
+
+	// Headers which can not be set with the headers object
+	reservedHeaders = []string{
+		"x-sg-id", "x-sg-eid", "received", "dkim-signature", "content-type", "content-transfer-encoding",
+		"to", "from", "subject", "reply-to", "cc", "bcc",
+	}
+)
+
+// Rules of the mail/send payload. Every rule adds its errors to the response.
+var rules = []func(postRequest *PostRequest, errorResponse *ErrorResponse){
+	validatePersonalizations,
+	validateRecipients,
+	validateFrom,
+	validateReplyTo,
+	validateSubject,
+	validateContent,
+	validateAttachments,
+	validateTemplate,
+	validateHeaders,
+	validateCustomArgs,
+	validateSubstitutions,
+	validateCategories,
+	validateASM,
+	validateSchedule,
+	validateMailSettings,
+}
+
+func validatePersonalizations(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	// A missing array is reported by the validator, an empty one here
+	if postRequest.Personalizations != nil && len(postRequest.Personalizations) == 0 {
+		errorResponse.Add(
+			"The personalizations field is required and must have at least one personalization.",
+			"personalizations",
+			helpURL+"#-Personalizations-Errors",
+		)
+	}
+
+	if len(postRequest.Personalizations) > maxPersonalizations {
+		errorResponse.Add(
+			"You may not have more than 1000 personalizations per API request. You may need to deliver your message in multiple requests.",
+			"personalizations",
+			helpURL+"#-Personalizations-Errors",
+		)
+	}
+
+	for i, personalization := range postRequest.Personalizations {
+		field := "personalizations." + strconv.Itoa(i)
+		if len(personalization.To) == 0 {
+			errorResponse.Add(
+				"The to array is required for all personalization objects, and must have at least one email object with a valid email address.",
+				field+".to",
+				helpURL+"#message.personalizations.to",
+			)
+		}
+
+		lists := []struct {
+			name      string
+			addresses []emailAddress
+		}{{"to", personalization.To}, {"cc", personalization.Cc}, {"bcc", personalization.Bcc}}
+
+		for _, list := range lists {
+			for j, address := range list.addresses {
+				if !IsValidEmail(address.Email) {
+					errorResponse.Add(
+						"Does not contain a valid address.",
+						field+"."+list.name+"."+strconv.Itoa(j)+".email",
+						helpURL+"#message.personalizations."+list.name,
+					)
+				}
+			}
+		}
+
+		// Duplicates are checked in the order of to, cc and bcc
+		seen := map[string]bool{}
+		duplicate := false
+		for _, list := range lists {
+			for _, address := range list.addresses {
+				key := strings.ToLower(address.Email)
+				if seen[key] && !duplicate {
+					duplicate = true
+					errorResponse.Add(
+						"Each email address in the personalization block should be unique between to, cc, and bcc. We found the first duplicate instance of ["+address.Email+"] in the "+field+"."+list.name+" field.",
+						field,
+						helpURL+"#message.recipient.duplicates",
+					)
+				}
+				seen[key] = true
+			}
+		}
+	}
+}
+
+func validateRecipients(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	total := 0
+	for _, personalization := range postRequest.Personalizations {
+		total += len(personalization.To) + len(personalization.Cc) + len(personalization.Bcc)
+	}
+	if total > maxRecipients {
+		errorResponse.Add(
+			"The total number of recipients must be less than 1000. This includes all recipients defined within the to, cc, and bcc parameters, across each object that you include in the personalizations array.",
+			"personalizations",
+			helpURL+"#-Personalizations-Errors",
+		)
+	}
+}
+
+func validateFrom(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if postRequest.From.Email != "" && !IsValidEmail(postRequest.From.Email) {
+		errorResponse.Add(
+			"The from email does not contain a valid address.",
+			"from.email",
+			helpURL+"#message.from",
+		)
+	}
+}
+
+func validateReplyTo(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if postRequest.ReplyTo.Email != "" && !IsValidEmail(postRequest.ReplyTo.Email) {
+		errorResponse.Add(
+			"The reply_to email does not contain a valid address.",
+			"reply_to.email",
+			helpURL+"#message.reply_to",
+		)
+	}
+	if postRequest.ReplyTo.Email != "" && len(postRequest.ReplyToList) > 0 {
+		errorResponse.Add(
+			"The reply_to and reply_to_list properties are mutually exclusive. Please use only one of them.",
+			"reply_to_list",
+			helpURL+"#message.reply_to_list",
+		)
+	}
+	if len(postRequest.ReplyToList) > maxReplyToList {
+		errorResponse.Add(
+			"The reply_to_list may not have more than 1000 email objects.",
+			"reply_to_list",
+			helpURL+"#message.reply_to_list",
+		)
+	}
+	for i, address := range postRequest.ReplyToList {
+		if !IsValidEmail(address.Email) {
+			errorResponse.Add(
+				"The reply_to_list email does not contain a valid address.",
+				"reply_to_list."+strconv.Itoa(i)+".email",
+				helpURL+"#message.reply_to_list",
+			)
+		}
+	}
+}
+
+// Subject is required unless a template is used or every personalization has a subject
+func validateSubject(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if postRequest.Subject != "" || postRequest.TemplateId != "" || len(postRequest.Personalizations) == 0 {
+		return
+	}
+	for _, personalization := range postRequest.Personalizations {
+		if personalization.Subject == "" {
+			errorResponse.Add(
+				"The subject is required. You can get around this requirement if you use a template with a subject defined or if every personalization has a subject defined.",
+				"subject",
+				helpURL+"#message.subject",
+			)
+			return
+		}
+	}
+}
+
+// Content types must be ordered text/plain, text/html and the others
+func validateContent(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	rank := 0
+	for i, content := range postRequest.Content {
+		field := "content." + strconv.Itoa(i)
+		if content.Type == "" {
+			errorResponse.Add(
+				"The content type must be a string at least one character in length.",
+				field+".type",
+				helpURL+"#message.content.type",
+			)
+		}
+		if content.Value == "" {
+			errorResponse.Add(
+				"The content value must be a string at least one character in length.",
+				field+".value",
+				helpURL+"#message.content.value",
+			)
+		}
+
+		r := 2
+		switch strings.ToLower(content.Type) {
+		case "text/plain":
+			r = 0
+		case "text/html":
+			r = 1
+		}
+		if r < rank {
+			errorResponse.Add(
+				"If present, text/plain and text/html may only be provided in this order: text/plain, text/html, then any other content.",
+				field+".type",
+				helpURL+"#message.content.type",
+			)
+		}
+		if r > rank {
+			rank = r
+		}
+	}
+}
+
+func validateAttachments(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	for i, attachment := range postRequest.Attachments {
+		field := "attachments." + strconv.Itoa(i)
+		if attachment.Content == "" {
+			errorResponse.Add(
+				"The attachment content is required.",
+				field+".content",
+				helpURL+"#message.attachments.content",
+			)
+		} else if _, err := base64.StdEncoding.DecodeString(attachment.Content); err != nil {
+			errorResponse.Add(
+				"The attachment content must be base64 encoded.",
+				field+".content",
+				helpURL+"#message.attachments.content",
+			)
+		}
+		if attachment.Filename == "" {
+			errorResponse.Add(
+				"The attachment filename parameter is required.",
+				field+".filename",
+				helpURL+"#message.attachments.filename",
+			)
+		}
+		if attachment.Disposition != "" && attachment.Disposition != "inline" && attachment.Disposition != "attachment" {
+			errorResponse.Add(
+				"The disposition of your attachment can be either \"inline\" or \"attachment\".",
+				field+".disposition",
+				helpURL+"#message.attachments.disposition",
+			)
+		}
+		if attachment.Disposition == "inline" && attachment.ContentId == "" {
+			errorResponse.Add(
+				"The content_id parameter is required if your attachment disposition is inline.",
+				field+".content_id",
+				helpURL+"#message.attachments.content_id",
+			)
+		}
+	}
+}
+
+func validateTemplate(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if postRequest.TemplateId == "" {
+		return
+	}
+	if !templates.IsValidID(postRequest.TemplateId) {
+		errorResponse.Add(
+			"The template_id must be a valid GUID, you provided '"+postRequest.TemplateId+"'.",
+			"template_id",
+			helpURL+"#message.template_id",
+		)
+		return
+	}
+	template, _, ok := postRequest.getInstance().Templates.For(postRequest.Subuser).Active(postRequest.TemplateId)
+	if !ok {
+		errorResponse.Add(
+			"The template_id is not a valid template ID.",
+			"template_id",
+			helpURL+"#message.template_id",
+		)
+		return
+	}
+
+	// Dynamic templates take dynamic_template_data instead of the legacy substitutions
+	if template.Generation != templates.GenerationDynamic {
+		return
+	}
+	for i, personalization := range postRequest.Personalizations {
+		if len(personalization.Substitutions) > 0 {
+			errorResponse.Add(
+				"Substitutions may not be used with dynamic templating",
+				"personalizations."+strconv.Itoa(i)+".substitutions",
+				helpURL+"#message.personalizations.substitutions",
+			)
+		}
+	}
+	if len(postRequest.Sections) > 0 {
+		errorResponse.Add(
+			"Substitutions may not be used with dynamic templating",
+			"sections",
+			helpURL+"#message.sections",
+		)
+	}
+}
+
+func validateHeaders(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	validate := func(headers map[string]string, field string) {
+		for _, name := range sortedKeys(headers) {
+			if !headerNamePattern.MatchString(name) {
+				errorResponse.Add(
+					"Header names must only contain printable ASCII characters without spaces or colons. You provided '"+name+"'.",
+					field,
+					helpURL+"#message.headers",
+				)
+				continue
+			}
+			if IsReservedHeader(name) {
+				errorResponse.Add(
+					"The following header is reserved and cannot be used: "+name+".",
+					field,
+					helpURL+"#message.headers",
+				)
+			}
+		}
+	}
+
+	validate(postRequest.Headers, "headers")
+	for i, personalization := range postRequest.Personalizations {
+		validate(personalization.Headers, "personalizations."+strconv.Itoa(i)+".headers")
+	}
+}
+
+// custom_args of the request and each personalization are limited to 10,000 bytes in total
+func validateCustomArgs(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	size := func(customArgs map[string]string) int {
+		if len(customArgs) == 0 {
+			return 0
+		}
+		data, _ := json.Marshal(customArgs)
+		return len(data)
+	}
+
+	if size(postRequest.CustomArgs) > maxCustomArgsSize {
+		errorResponse.Add(
+			"The custom_args must be less than 10000 bytes.",
+			"custom_args",
+			helpURL+"#message.custom_args",
+		)
+		return
+	}
+	for i, personalization := range postRequest.Personalizations {
+		if size(postRequest.CustomArgs)+size(personalization.CustomArgs) > maxCustomArgsSize {
+			errorResponse.Add(
+				"The custom_args for each personalization must be less than 10000 bytes, including the custom_args of the request.",
+				"personalizations."+strconv.Itoa(i)+".custom_args",
+				helpURL+"#message.custom_args",
+			)
+		}
+	}
+}
+
+// substitutions of each personalization are limited to 10,000 bytes
+func validateSubstitutions(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	for i, personalization := range postRequest.Personalizations {
+		size := 0
+		for key, value := range personalization.Substitutions {
+			size += len(key) + len(value)
+		}
+		if size > maxSubstitutionSize {
+			errorResponse.Add(
+				"The substitutions for each personalization must be less than 10000 bytes.",
+				"personalizations."+strconv.Itoa(i)+".substitutions",
+				helpURL+"#message.personalizations.substitutions",
+			)
+		}
+	}
+}
+
+func validateCategories(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if len(postRequest.Categories) > maxCategories {
+		errorResponse.Add(
+			"You may not have more than 10 categories per request.",
+			"categories",
+			helpURL+"#message.categories",
+		)
+	}
+	for i, category := range postRequest.Categories {
+		if len(category) > maxCategoryLength {
+			errorResponse.Add(
+				"A category cannot exceed 255 characters.",
+				"categories."+strconv.Itoa(i),
+				helpURL+"#message.categories",
+			)
+		}
+	}
+}
+
+func validateASM(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	if postRequest.Asm == nil {
+		return
+	}
+	if _, ok := postRequest.getInstance().Groups.For(postRequest.Subuser).Get(postRequest.Asm.GroupId); !ok {
+		errorResponse.Add(
+			"The asm.group_id must be a valid unsubscribe group ID.",
+			"asm.group_id",
+			helpURL+"#message.asm.group_id",
+		)
+	}
+	if len(postRequest.Asm.GroupsToDisplay) > 25 {
+		errorResponse.Add(
+			"The asm.groups_to_display cannot contain more than 25 groups.",
+			"asm.groups_to_display",
+			helpURL+"#message.asm.groups_to_display",
+		)
+	}
+	for _, groupID := range postRequest.Asm.GroupsToDisplay {
+		if _, ok := postRequest.getInstance().Groups.For(postRequest.Subuser).Get(groupID); !ok {
+			errorResponse.Add(
+				"The asm.groups_to_display must only contain valid unsubscribe group IDs.",
+				"asm.groups_to_display",
+				helpURL+"#message.asm.groups_to_display",
+			)
+			break
+		}
+	}
+}
+
+func validateSchedule(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	limit := postRequest.getInstance().Scheduler.Now().Add(maxScheduleAhead).Unix()
+	if postRequest.SendAt < 0 || postRequest.SendAt > limit {
+		errorResponse.Add(
+			"The send_at parameter must be a unix timestamp no more than 72 hours in the future.",
+			"send_at",
+			helpURL+"#message.send_at",
+		)
+	}
+	for i, personalization := range postRequest.Personalizations {
+		if personalization.SendAt < 0 || personalization.SendAt > limit {
+			errorResponse.Add(
+				"The send_at parameter must be a unix timestamp no more than 72 hours in the future.",
+				"personalizations."+strconv.Itoa(i)+".send_at",
+				helpURL+"#message.personalizations.send_at",
+			)
+		}
+	}
+	if postRequest.BatchId != "" && !postRequest.getInstance().Scheduler.HasBatch(postRequest.BatchId) {
+		errorResponse.Add(
+			"The batch_id must be a batch ID created with /v3/mail/batch.",
+			"batch_id",
+			helpURL+"#message.batch_id",
+		)
+	}
+}
+
+func validateMailSettings(postRequest *PostRequest, errorResponse *ErrorResponse) {
+	mailSettings := postRequest.MailSettings
+	if mailSettings.BypassListManagement.Enable &&
+		(mailSettings.BypassSpamManagement.Enable || mailSettings.BypassBounceManagement.Enable || mailSettings.BypassUnsubscribeManagement.Enable) {
+		errorResponse.Add(
+			"The bypass_list_management setting cannot be combined with bypass_spam_management, bypass_bounce_management or bypass_unsubscribe_management.",
+			"mail_settings.bypass_list_management",
+			helpURL+"#message.mail_settings.bypass_list_management",
+		)
+	}
+	if spamCheck := mailSettings.SpamCheck; spamCheck.Enable {
+		if spamCheck.Threshold < 1 || spamCheck.Threshold > 10 {
+			errorResponse.Add(
+				"The spam_check threshold must be an integer between 1 and 10.",
+				"mail_settings.spam_check.threshold",
+				helpURL+"#message.mail_settings.spam_check.threshold",
+			)
+		}
+		if spamCheck.PostToUrl != "" && !urlPattern.MatchString(spamCheck.PostToUrl) {
+			errorResponse.Add(
+				"The spam_check post_to_url must be a valid URL.",
+				"mail_settings.spam_check.post_to_url",
+				helpURL+"#message.mail_settings.spam_check.post_to_url",
+			)
+		}
+	}
+}
+
+// Get approximate size of the message (content and decoded attachments)
+func (postRequest *PostRequest) size() int {
+	size := 0
+	for _, content := range postRequest.Content {
+		size += len(content.Value)
+	}
+	for _, attachment := range postRequest.Attachments {
+		size += base64.StdEncoding.DecodedLen(len(attachment.Content))
+	}
+	return size
+}
+
+// Check email syntax
+func IsValidEmail(email string) bool {
+	return emailPattern.MatchString(email)
+}
+
+// Check if header can not be set with the headers object
+func IsReservedHeader(name string) bool {
+	for _, reserved := range reservedHeaders {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
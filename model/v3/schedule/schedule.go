@@ -0,0 +1,207 @@
+package schedule
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of scheduled sends
+const (
+	StatusPause  = "pause"
+	StatusCancel = "cancel"
+)
+
+// Status of a batch, the object of /v3/user/scheduled_sends
+type Status struct {
+	BatchID string `json:"batch_id"`
+	Status  string `json:"status"`
+}
+
+// Job is a message held until SendAt
+type Job struct {
+	BatchID string
+	SendAt  int64
+	Send    func()
+}
+
+type Scheduler struct {
+	mu      sync.Mutex
+	offset  time.Duration
+	batches map[string]string
+	jobs    []Job
+	// Runs at SendAt of the earliest held job
+	timer *time.Timer
+	// Set by Stop, the timer is not set any more
+	stopped bool
+}
+
+// Default scheduler used by mail/send and the API
+var Default = NewScheduler()
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{batches: map[string]string{}}
+}
+
+// Get current time of the scheduler clock. The clock runs with the real time plus the advanced duration.
+func (s *Scheduler) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Now().Add(s.offset)
+}
+
+// Advance the clock and send the jobs which became due
+func (s *Scheduler) Advance(d time.Duration) time.Time {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+
+	s.Run()
+	return s.Now()
+}
+
+// Reset the clock to the real time
+func (s *Scheduler) Reset() {
+	s.mu.Lock()
+	s.offset = 0
+	s.mu.Unlock()
+
+	s.Run()
+}
+
+// Create batch ID
+func (s *Scheduler) CreateBatch() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := newBatchID()
+	s.batches[id] = ""
+	return id
+}
+
+// Check if batch ID was created
+func (s *Scheduler) HasBatch(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.batches[id]
+	return ok
+}
+
+// Set status of batch. An empty status resumes the scheduled sends.
+func (s *Scheduler) SetStatus(id string, status string) bool {
+	s.mu.Lock()
+	if _, ok := s.batches[id]; !ok {
+		s.mu.Unlock()
+		return false
+	}
+	s.batches[id] = status
+	s.mu.Unlock()
+
+	if status == "" {
+		s.Run()
+	}
+	return true
+}
+
+// Get status of batch. The status is empty when the batch is neither paused nor canceled.
+func (s *Scheduler) Status(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.batches[id]
+	return status, ok
+}
+
+// List paused and canceled batches
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := []Status{}
+	for id, status := range s.batches {
+		if status != "" {
+			statuses = append(statuses, Status{BatchID: id, Status: status})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].BatchID < statuses[j].BatchID
+	})
+	return statuses
+}
+
+// Hold job until SendAt. The job is sent at once when it is already due.
+func (s *Scheduler) Schedule(job Job) {
+	s.mu.Lock()
+	s.jobs = append(s.jobs, job)
+	s.mu.Unlock()
+
+	s.Run()
+}
+
+// Get count of the held jobs
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+// Send due jobs and set the timer for the next job. Jobs of paused batches are held until resumed and jobs of canceled batches are discarded.
+func (s *Scheduler) Run() {
+	s.mu.Lock()
+	now := time.Now().Add(s.offset)
+	var due, held []Job
+	var next int64
+	for _, job := range s.jobs {
+		switch {
+		case job.BatchID != "" && s.batches[job.BatchID] == StatusCancel:
+			// Discard
+		case job.BatchID != "" && s.batches[job.BatchID] == StatusPause:
+			held = append(held, job)
+		case job.SendAt > now.Unix():
+			held = append(held, job)
+			if next == 0 || job.SendAt < next {
+				next = job.SendAt
+			}
+		default:
+			due = append(due, job)
+		}
+	}
+	s.jobs = held
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if next != 0 && !s.stopped {
+		s.timer = time.AfterFunc(time.Unix(next, 0).Sub(now), s.Run)
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].SendAt < due[j].SendAt
+	})
+	for _, job := range due {
+		job.Send()
+	}
+}
+
+// Stop the timer and discard the held jobs. Jobs scheduled later are only sent when already due.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	s.jobs = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+func newBatchID() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
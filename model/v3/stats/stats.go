@@ -0,0 +1,377 @@
+package stats
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+)
+
+// Aggregation periods
+const (
+	AggregatedByDay   = "day"
+	AggregatedByWeek  = "week"
+	AggregatedByMonth = "month"
+)
+
+// Types of grouped stats
+const (
+	TypeCategory        = "category"
+	TypeMailboxProvider = "mailbox_provider"
+	TypeCountry         = "country"
+)
+
+const dateFormat = "2006-01-02"
+
+// Metrics of global and category stats
+var GlobalMetrics = []string{
+	"blocks", "bounce_drops", "bounces", "clicks", "deferred", "delivered", "invalid_emails", "opens", "processed",
+	"requests", "spam_report_drops", "spam_reports", "unique_clicks", "unique_opens", "unsubscribe_drops", "unsubscribes",
+}
+
+// Metrics of mailbox provider stats
+var MailboxProviderMetrics = []string{
+	"blocks", "bounces", "clicks", "deferred", "delivered", "drops", "opens", "processed", "requests",
+	"spam_reports", "unique_clicks", "unique_opens",
+}
+
+// Metrics of geo stats
+var GeoMetrics = []string{"clicks", "opens", "unique_clicks", "unique_opens"}
+
+// Mailbox providers by the domain of the recipient. Others are "Other".
+var mailboxProviders = map[string]string{
+	"gmail.com":      "Gmail",
+	"googlemail.com": "Gmail",
+	"yahoo.com":      "Yahoo",
+	"ymail.com":      "Yahoo",
+	"outlook.com":    "Microsoft Outlook Live",
+	"hotmail.com":    "Microsoft Outlook Live",
+	"live.com":       "Microsoft Outlook Live",
+	"msn.com":        "Microsoft Outlook Live",
+	"aol.com":        "AOL",
+	"icloud.com":     "Apple iCloud",
+	"me.com":         "Apple iCloud",
+	"mac.com":        "Apple iCloud",
+}
+
+// Country of the events without the country field
+const defaultCountry = "US"
+
+// Dropped event reasons counted as the drop metrics
+var dropMetrics = map[string]string{
+	"Bounced Address":        "bounce_drops",
+	"Spam Reporting Address": "spam_report_drops",
+	"Unsubscribed Address":   "unsubscribe_drops",
+	"Invalid":                "invalid_emails",
+}
+
+var (
+	ErrStartDate    = errors.New("start_date is invalid")
+	ErrEndDate      = errors.New("end_date is invalid")
+	ErrAggregatedBy = errors.New("aggregated_by must be one of [day, week, month]")
+)
+
+type Metrics map[string]int
+
+type Stat struct {
+	Type    string  `json:"type,omitempty"`
+	Name    string  `json:"name,omitempty"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// Stats of a date, the object of the stats endpoints
+type DateStats struct {
+	Date  string `json:"date"`
+	Stats []Stat `json:"stats"`
+}
+
+// Dates of stats. End is the last day, inclusive.
+type Period struct {
+	Start        time.Time
+	End          time.Time
+	AggregatedBy string
+}
+
+// Grouping of stats. Names selects the groups, all groups found in the events when empty.
+type Grouping struct {
+	Type    string
+	Names   []string
+	Group   func(event webhook.Event) []string
+	Metrics []string
+}
+
+// Parse start_date, end_date (today by default) and aggregated_by (day by default)
+func ParsePeriod(startDate string, endDate string, aggregatedBy string) (Period, error) {
+	period := Period{AggregatedBy: aggregatedBy}
+	start, err := time.Parse(dateFormat, startDate)
+	if err != nil {
+		return period, ErrStartDate
+	}
+	period.Start = start
+
+	period.End = time.Now().UTC().Truncate(24 * time.Hour)
+	if endDate != "" {
+		if period.End, err = time.Parse(dateFormat, endDate); err != nil {
+			return period, ErrEndDate
+		}
+	}
+	if period.End.Before(period.Start) {
+		return period, ErrEndDate
+	}
+
+	switch aggregatedBy {
+	case "":
+		period.AggregatedBy = AggregatedByDay
+	case AggregatedByDay, AggregatedByWeek, AggregatedByMonth:
+	default:
+		return period, ErrAggregatedBy
+	}
+	return period, nil
+}
+
+// Global stats, which are not grouped
+func Global() Grouping {
+	return Grouping{
+		Group:   func(event webhook.Event) []string { return []string{""} },
+		Names:   []string{""},
+		Metrics: GlobalMetrics,
+	}
+}
+
+// Stats grouped by category
+func Categories(names []string) Grouping {
+	return Grouping{Type: TypeCategory, Names: names, Group: categories, Metrics: GlobalMetrics}
+}
+
+// Stats grouped by the mailbox provider of the recipient
+func MailboxProviders(names []string) Grouping {
+	return Grouping{Type: TypeMailboxProvider, Names: names, Group: mailboxProvider, Metrics: MailboxProviderMetrics}
+}
+
+// Stats grouped by the country field of the events
+func Countries(names []string) Grouping {
+	return Grouping{Type: TypeCountry, Names: names, Group: country, Metrics: GeoMetrics}
+}
+
+// Aggregate events of the period by date and group
+func Aggregate(events []webhook.Event, period Period, grouping Grouping) []DateStats {
+	buckets := map[string]map[string]*counter{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		date, ok := period.bucket(event.Time())
+		if !ok {
+			continue
+		}
+		for _, name := range grouping.Group(event) {
+			seen[name] = true
+			if buckets[date] == nil {
+				buckets[date] = map[string]*counter{}
+			}
+			if buckets[date][name] == nil {
+				buckets[date][name] = newCounter()
+			}
+			buckets[date][name].add(event)
+		}
+	}
+
+	names := grouping.Names
+	if len(names) == 0 {
+		names = sortedKeys(seen)
+	}
+
+	list := []DateStats{}
+	for _, date := range period.dates() {
+		dateStats := DateStats{Date: date, Stats: []Stat{}}
+		for _, name := range names {
+			c := buckets[date][name]
+			if c == nil {
+				c = newCounter()
+			}
+			dateStats.Stats = append(dateStats.Stats, Stat{Type: grouping.Type, Name: name, Metrics: c.metrics(grouping.Metrics)})
+		}
+		list = append(list, dateStats)
+	}
+	return list
+}
+
+// Sum stats of the period by group
+func Sum(events []webhook.Event, period Period, grouping Grouping) DateStats {
+	counters := map[string]*counter{}
+	for _, event := range events {
+		if _, ok := period.bucket(event.Time()); !ok {
+			continue
+		}
+		for _, name := range grouping.Group(event) {
+			if counters[name] == nil {
+				counters[name] = newCounter()
+			}
+			counters[name].add(event)
+		}
+	}
+
+	names := grouping.Names
+	if len(names) == 0 {
+		names = sortedKeys(counters)
+	}
+	sums := DateStats{Date: period.Start.Format(dateFormat), Stats: []Stat{}}
+	for _, name := range names {
+		c := counters[name]
+		if c == nil {
+			c = newCounter()
+		}
+		sums.Stats = append(sums.Stats, Stat{Type: grouping.Type, Name: name, Metrics: c.metrics(grouping.Metrics)})
+	}
+	return sums
+}
+
+// Sort stats by metric
+func SortBy(stats []Stat, metric string, descending bool) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		if descending {
+			return stats[i].Metrics[metric] > stats[j].Metrics[metric]
+		}
+		return stats[i].Metrics[metric] < stats[j].Metrics[metric]
+	})
+}
+
+// Get date of the bucket of t. The first bucket starts at Start even in the middle of a week or month.
+func (p Period) bucket(t time.Time) (string, bool) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	if day.Before(p.Start) || day.After(p.End) {
+		return "", false
+	}
+
+	switch p.AggregatedBy {
+	case AggregatedByWeek:
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case AggregatedByMonth:
+		day = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	if day.Before(p.Start) {
+		day = p.Start
+	}
+	return day.Format(dateFormat), true
+}
+
+// Get dates of the buckets in the period
+func (p Period) dates() []string {
+	dates := []string{}
+	for day := p.Start; !day.After(p.End); day = day.AddDate(0, 0, 1) {
+		date, _ := p.bucket(day)
+		if len(dates) == 0 || dates[len(dates)-1] != date {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// Counts of events, where opens and clicks are also counted per recipient of message
+type counter struct {
+	counts  map[string]int
+	opened  map[string]bool
+	clicked map[string]bool
+}
+
+func newCounter() *counter {
+	return &counter{counts: map[string]int{}, opened: map[string]bool{}, clicked: map[string]bool{}}
+}
+
+func (c *counter) add(event webhook.Event) {
+	recipient, _ := event["sg_message_id"].(string)
+	if email, ok := event["email"].(string); ok {
+		recipient += " " + email
+	}
+
+	eventType, _ := event["event"].(string)
+	switch eventType {
+	case "processed", "deferred", "delivered":
+		c.counts[eventType]++
+	case "dropped":
+		c.counts["drops"]++
+		reason, _ := event["reason"].(string)
+		if metric, ok := dropMetrics[reason]; ok {
+			c.counts[metric]++
+		}
+	case "bounce":
+		if event["type"] == "blocked" {
+			c.counts["blocks"]++
+		} else {
+			c.counts["bounces"]++
+		}
+	case "open":
+		c.counts["opens"]++
+		if !c.opened[recipient] {
+			c.opened[recipient] = true
+			c.counts["unique_opens"]++
+		}
+	case "click":
+		c.counts["clicks"]++
+		if !c.clicked[recipient] {
+			c.clicked[recipient] = true
+			c.counts["unique_clicks"]++
+		}
+	case "spamreport":
+		c.counts["spam_reports"]++
+	case "unsubscribe":
+		c.counts["unsubscribes"]++
+	}
+}
+
+// Get metrics by name. requests are the processed and dropped recipients.
+func (c *counter) metrics(names []string) Metrics {
+	metrics := Metrics{}
+	for _, name := range names {
+		switch name {
+		case "requests":
+			metrics[name] = c.counts["processed"] + c.counts["drops"]
+		default:
+			metrics[name] = c.counts[name]
+		}
+	}
+	return metrics
+}
+
+func categories(event webhook.Event) []string {
+	switch category := event["category"].(type) {
+	case string:
+		return []string{category}
+	case []string:
+		return category
+	case []interface{}:
+		names := []string{}
+		for _, name := range category {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func mailboxProvider(event webhook.Event) []string {
+	email, _ := event["email"].(string)
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	if provider, ok := mailboxProviders[domain]; ok {
+		return []string{provider}
+	}
+	return []string{"Other"}
+}
+
+func country(event webhook.Event) []string {
+	if country, ok := event["country"].(string); ok && country != "" {
+		return []string{strings.ToUpper(country)}
+	}
+	return []string{defaultCountry}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
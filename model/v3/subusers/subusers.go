@@ -0,0 +1,120 @@
+package subusers
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Subuser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Disabled bool   `json:"disabled"`
+}
+
+type Store struct {
+	mu       sync.RWMutex
+	nextID   int
+	subusers map[string]*Subuser
+}
+
+// Default store used by the API and the on-behalf-of header
+var Default = NewStore()
+
+func NewStore() *Store {
+	return &Store{nextID: 1, subusers: map[string]*Subuser{}}
+}
+
+// Create subuser. ok is false when the username exists.
+func (s *Store) Create(username string, email string) (Subuser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subusers[normalize(username)]; ok {
+		return Subuser{}, false
+	}
+	subuser := Subuser{ID: s.nextID, Username: username, Email: email}
+	s.nextID++
+	s.subusers[normalize(username)] = &subuser
+	return subuser, true
+}
+
+// Get subuser by username
+func (s *Store) Get(username string) (Subuser, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subuser, ok := s.subusers[normalize(username)]
+	if !ok {
+		return Subuser{}, false
+	}
+	return *subuser, true
+}
+
+// List subusers by ID. Usernames are filtered by prefix.
+func (s *Store) List(username string) []Subuser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Subuser{}
+	for key, subuser := range s.subusers {
+		if strings.HasPrefix(key, normalize(username)) {
+			list = append(list, *subuser)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Enable or disable subuser
+func (s *Store) SetDisabled(username string, disabled bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subuser, ok := s.subusers[normalize(username)]
+	if !ok {
+		return false
+	}
+	subuser.Disabled = disabled
+	return true
+}
+
+// Delete subuser
+func (s *Store) Delete(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subusers[normalize(username)]; !ok {
+		return false
+	}
+	delete(s.subusers, normalize(username))
+	return true
+}
+
+// Get all subusers
+func (s *Store) Snapshot() []Subuser {
+	return s.List("")
+}
+
+// Replace all subusers
+func (s *Store) Restore(list []Subuser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID = 1
+	s.subusers = map[string]*Subuser{}
+	for i := range list {
+		s.subusers[normalize(list[i].Username)] = &list[i]
+		if list[i].ID >= s.nextID {
+			s.nextID = list[i].ID + 1
+		}
+	}
+}
+
+// Usernames are case insensitive
+func normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
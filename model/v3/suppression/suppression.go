@@ -0,0 +1,255 @@
+package suppression
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Bounces       = "bounces"
+	Blocks        = "blocks"
+	SpamReports   = "spam_reports"
+	InvalidEmails = "invalid_emails"
+	Unsubscribes  = "unsubscribes"
+)
+
+// Suppression lists
+var Lists = []string{Bounces, Blocks, SpamReports, InvalidEmails, Unsubscribes}
+
+// Lists to which the recipient of an event is added
+var EventLists = map[string]string{
+	"bounce":      Bounces,
+	"spamreport":  SpamReports,
+	"unsubscribe": Unsubscribes,
+}
+
+// Lists which drop recipients on send, with the reason of the "dropped" event.
+// Blocks are not dropped like SendGrid.
+var dropReasons = []struct {
+	List   string
+	Reason string
+}{
+	{Bounces, "Bounced Address"},
+	{SpamReports, "Spam Reporting Address"},
+	{InvalidEmails, "Invalid"},
+	{Unsubscribes, "Unsubscribed Address"},
+}
+
+type Suppression struct {
+	Created int64  `json:"created"`
+	Email   string `json:"email"`
+	Reason  string `json:"reason,omitempty"`
+	Status  string `json:"status,omitempty"`
+	IP      string `json:"ip,omitempty"`
+}
+
+// Filter for List. Zero values are ignored.
+type Filter struct {
+	StartTime int64
+	EndTime   int64
+	Limit     int
+	Offset    int
+}
+
+type Store struct {
+	mu    sync.RWMutex
+	lists map[string]map[string]Suppression
+}
+
+// Default store used by the API and mail/send
+var Default = NewStore()
+
+// Stores of the parent account and the subusers
+type Registry struct {
+	mu       sync.Mutex
+	parent   *Store
+	subusers map[string]*Store
+}
+
+// Default registry of Default and the stores of subusers
+var DefaultRegistry = NewRegistry(Default)
+
+func NewRegistry(parent *Store) *Registry {
+	return &Registry{parent: parent, subusers: map[string]*Store{}}
+}
+
+// Get store of subuser. The parent account ("") uses the parent store.
+func (r *Registry) For(subuser string) *Store {
+	if subuser == "" {
+		return r.parent
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	store, ok := r.subusers[subuser]
+	if !ok {
+		store = NewStore()
+		r.subusers[subuser] = store
+	}
+	return store
+}
+
+// Delete store of subuser
+func (r *Registry) DeleteFor(subuser string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subusers, subuser)
+}
+
+// Get suppressions of the parent account ("") and every subuser by list
+func (r *Registry) Snapshot() map[string]map[string][]Suppression {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := map[string]map[string][]Suppression{"": r.parent.all()}
+	for subuser, store := range r.subusers {
+		snapshot[subuser] = store.all()
+	}
+	return snapshot
+}
+
+// Replace suppressions of the parent account and the subusers
+func (r *Registry) Restore(snapshot map[string]map[string][]Suppression) {
+	for subuser, lists := range snapshot {
+		store := r.For(subuser)
+		for _, list := range Lists {
+			store.DeleteAll(list)
+			for _, suppression := range lists[list] {
+				store.Add(list, suppression)
+			}
+		}
+	}
+}
+
+func NewStore() *Store {
+	lists := map[string]map[string]Suppression{}
+	for _, list := range Lists {
+		lists[list] = map[string]Suppression{}
+	}
+	return &Store{lists: lists}
+}
+
+// Add suppression to list. Created is set when zero.
+func (s *Store) Add(list string, suppression Suppression) Suppression {
+	suppression.Email = normalize(suppression.Email)
+	if suppression.Created == 0 {
+		suppression.Created = time.Now().Unix()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lists[list][suppression.Email] = suppression
+	return suppression
+}
+
+// Get suppression of email in list
+func (s *Store) Get(list string, email string) (Suppression, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suppression, ok := s.lists[list][normalize(email)]
+	return suppression, ok
+}
+
+// List suppressions, newest first
+func (s *Store) List(list string, filter Filter) []Suppression {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suppressions := []Suppression{}
+	for _, suppression := range s.lists[list] {
+		if filter.StartTime > 0 && suppression.Created < filter.StartTime {
+			continue
+		}
+		if filter.EndTime > 0 && suppression.Created > filter.EndTime {
+			continue
+		}
+		suppressions = append(suppressions, suppression)
+	}
+	sort.Slice(suppressions, func(i, j int) bool {
+		if suppressions[i].Created == suppressions[j].Created {
+			return suppressions[i].Email < suppressions[j].Email
+		}
+		return suppressions[i].Created > suppressions[j].Created
+	})
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(suppressions) {
+			return []Suppression{}
+		}
+		suppressions = suppressions[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(suppressions) {
+		suppressions = suppressions[:filter.Limit]
+	}
+	return suppressions
+}
+
+// Delete email from list
+func (s *Store) Delete(list string, email string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = normalize(email)
+	if _, ok := s.lists[list][email]; !ok {
+		return false
+	}
+	delete(s.lists[list], email)
+	return true
+}
+
+// Delete all emails from list
+func (s *Store) DeleteAll(list string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lists[list] = map[string]Suppression{}
+}
+
+func (s *Store) all() map[string][]Suppression {
+	lists := map[string][]Suppression{}
+	for _, list := range Lists {
+		lists[list] = s.List(list, Filter{})
+	}
+	return lists
+}
+
+// Get the reason to drop email on send. Bypassed lists are not checked.
+func (s *Store) DropReason(email string, bypass ...string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	email = normalize(email)
+	for _, dropReason := range dropReasons {
+		if contains(bypass, dropReason.List) {
+			continue
+		}
+		if _, ok := s.lists[dropReason.List][email]; ok {
+			return dropReason.Reason, true
+		}
+	}
+	return "", false
+}
+
+// Check list name
+func IsList(list string) bool {
+	return contains(Lists, list)
+}
+
+func contains(lists []string, list string) bool {
+	for _, l := range lists {
+		if l == list {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,62 @@
+package templates
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/aymerick/raymond"
+)
+
+// Handlebars helpers supported by SendGrid dynamic templates
+func init() {
+	raymond.RegisterHelpers(map[string]interface{}{
+		"equals": func(a interface{}, b interface{}, options *raymond.Options) interface{} {
+			return block(raymond.Str(a) == raymond.Str(b), options)
+		},
+		"notEquals": func(a interface{}, b interface{}, options *raymond.Options) interface{} {
+			return block(raymond.Str(a) != raymond.Str(b), options)
+		},
+		"greaterThan": func(a interface{}, b interface{}, options *raymond.Options) interface{} {
+			return block(toFloat(a) > toFloat(b), options)
+		},
+		"lessThan": func(a interface{}, b interface{}, options *raymond.Options) interface{} {
+			return block(toFloat(a) < toFloat(b), options)
+		},
+		"and": func(options *raymond.Options) interface{} {
+			for _, param := range options.Params() {
+				if !raymond.IsTrue(param) {
+					return block(false, options)
+				}
+			}
+			return block(true, options)
+		},
+		"or": func(options *raymond.Options) interface{} {
+			for _, param := range options.Params() {
+				if raymond.IsTrue(param) {
+					return block(true, options)
+				}
+			}
+			return block(false, options)
+		},
+		"length": func(value interface{}) int {
+			v := reflect.ValueOf(value)
+			switch v.Kind() {
+			case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+				return v.Len()
+			}
+			return 0
+		},
+	})
+}
+
+func block(ok bool, options *raymond.Options) interface{} {
+	if ok {
+		return options.Fn()
+	}
+	return options.Inverse()
+}
+
+func toFloat(value interface{}) float64 {
+	f, _ := strconv.ParseFloat(raymond.Str(value), 64)
+	return f
+}
@@ -0,0 +1,463 @@
+package templates
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aymerick/raymond"
+)
+
+const (
+	GenerationLegacy  = "legacy"
+	GenerationDynamic = "dynamic"
+
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	dynamicIDPattern = regexp.MustCompile(`^d-[0-9a-f]{32}$`)
+	legacyIDPattern  = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrVersionNotFound  = errors.New("version not found")
+)
+
+type Template struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Generation string    `json:"generation"`
+	UpdatedAt  string    `json:"updated_at"`
+	Versions   []Version `json:"versions"`
+}
+
+type Version struct {
+	ID           string `json:"id"`
+	TemplateID   string `json:"template_id"`
+	Active       int    `json:"active"`
+	Name         string `json:"name"`
+	HTMLContent  string `json:"html_content"`
+	PlainContent string `json:"plain_content"`
+	Subject      string `json:"subject"`
+	Editor       string `json:"editor"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// Template file loaded from SENDGRID_DEV_TEMPLATE_DIR
+type templateFile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Generation   string `json:"generation"`
+	Subject      string `json:"subject"`
+	HTMLContent  string `json:"html_content"`
+	PlainContent string `json:"plain_content"`
+}
+
+type Store struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+}
+
+// Default store used by the API and mail/send
+var Default = NewStore()
+
+// Stores of the parent account and the subusers
+type Registry struct {
+	mu       sync.Mutex
+	parent   *Store
+	subusers map[string]*Store
+}
+
+// Default registry of Default and the stores of subusers
+var DefaultRegistry = NewRegistry(Default)
+
+func NewRegistry(parent *Store) *Registry {
+	return &Registry{parent: parent, subusers: map[string]*Store{}}
+}
+
+// Get store of subuser. The parent account ("") uses the parent store.
+func (r *Registry) For(subuser string) *Store {
+	if subuser == "" {
+		return r.parent
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	store, ok := r.subusers[subuser]
+	if !ok {
+		store = NewStore()
+		r.subusers[subuser] = store
+	}
+	return store
+}
+
+// Delete store of subuser
+func (r *Registry) DeleteFor(subuser string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subusers, subuser)
+}
+
+// Get templates of the parent account ("") and every subuser
+func (r *Registry) Snapshot() map[string][]Template {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := map[string][]Template{"": r.parent.all()}
+	for subuser, store := range r.subusers {
+		snapshot[subuser] = store.all()
+	}
+	return snapshot
+}
+
+// Replace templates of the parent account and the subusers
+func (r *Registry) Restore(snapshot map[string][]Template) {
+	for subuser, list := range snapshot {
+		store := r.For(subuser)
+		store.mu.Lock()
+		store.templates = map[string]*Template{}
+		for i := range list {
+			store.templates[list[i].ID] = &list[i]
+		}
+		store.mu.Unlock()
+	}
+}
+
+func NewStore() *Store {
+	return &Store{templates: map[string]*Template{}}
+}
+
+// Create template with a new ID for the generation
+func (s *Store) Create(name string, generation string) Template {
+	if generation == "" {
+		generation = GenerationLegacy
+	}
+
+	id := newUUID()
+	if generation == GenerationDynamic {
+		id = "d-" + strings.ReplaceAll(id, "-", "")
+	}
+
+	return s.put(Template{
+		ID:         id,
+		Name:       name,
+		Generation: generation,
+		UpdatedAt:  time.Now().UTC().Format(timeFormat),
+		Versions:   []Version{},
+	})
+}
+
+// Get template by ID
+func (s *Store) Get(id string) (Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return Template{}, false
+	}
+	return copyTemplate(template), true
+}
+
+// List templates of the generations by name
+func (s *Store) List(generations []string) []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Template{}
+	for _, template := range s.templates {
+		for _, generation := range generations {
+			if template.Generation == generation {
+				list = append(list, copyTemplate(template))
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (s *Store) all() []Template {
+	return s.List([]string{GenerationLegacy, GenerationDynamic})
+}
+
+// Update name of template
+func (s *Store) Update(id string, name string) (Template, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return Template{}, false
+	}
+	template.Name = name
+	template.UpdatedAt = time.Now().UTC().Format(timeFormat)
+	return copyTemplate(template), true
+}
+
+// Delete template and its versions
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return false
+	}
+	delete(s.templates, id)
+	return true
+}
+
+// Add version to template. The first version of a template is always active.
+func (s *Store) AddVersion(templateID string, version Version) (Version, error) {
+	if err := Parse(version); err != nil {
+		return Version{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return Version{}, ErrTemplateNotFound
+	}
+
+	version.ID = newUUID()
+	version.TemplateID = templateID
+	version.UpdatedAt = time.Now().UTC().Format(timeFormat)
+	if len(template.Versions) == 0 {
+		version.Active = 1
+	}
+	if version.Active == 1 {
+		for i := range template.Versions {
+			template.Versions[i].Active = 0
+		}
+	}
+	template.Versions = append(template.Versions, version)
+	template.UpdatedAt = version.UpdatedAt
+
+	return version, nil
+}
+
+// Get version of template
+func (s *Store) GetVersion(templateID string, versionID string) (Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return Version{}, ErrTemplateNotFound
+	}
+	i := findVersion(template, versionID)
+	if i < 0 {
+		return Version{}, ErrVersionNotFound
+	}
+	return template.Versions[i], nil
+}
+
+// Update version with update. Other versions are deactivated when the version becomes active.
+func (s *Store) UpdateVersion(templateID string, versionID string, update func(version *Version)) (Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return Version{}, ErrTemplateNotFound
+	}
+	i := findVersion(template, versionID)
+	if i < 0 {
+		return Version{}, ErrVersionNotFound
+	}
+
+	version := template.Versions[i]
+	update(&version)
+	if err := Parse(version); err != nil {
+		return Version{}, err
+	}
+	version.ID = versionID
+	version.TemplateID = templateID
+	version.UpdatedAt = time.Now().UTC().Format(timeFormat)
+	if version.Active == 1 {
+		for j := range template.Versions {
+			template.Versions[j].Active = 0
+		}
+	}
+	template.Versions[i] = version
+	template.UpdatedAt = version.UpdatedAt
+
+	return version, nil
+}
+
+// Activate version of template
+func (s *Store) Activate(templateID string, versionID string) (Version, error) {
+	return s.UpdateVersion(templateID, versionID, func(version *Version) {
+		version.Active = 1
+	})
+}
+
+// Delete version of template
+func (s *Store) DeleteVersion(templateID string, versionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return ErrTemplateNotFound
+	}
+	i := findVersion(template, versionID)
+	if i < 0 {
+		return ErrVersionNotFound
+	}
+	template.Versions = append(template.Versions[:i], template.Versions[i+1:]...)
+	template.UpdatedAt = time.Now().UTC().Format(timeFormat)
+	return nil
+}
+
+// Get active version of template
+func (s *Store) Active(templateID string) (Template, Version, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return Template{}, Version{}, false
+	}
+	for _, version := range template.Versions {
+		if version.Active == 1 {
+			return copyTemplate(template), version, true
+		}
+	}
+	return Template{}, Version{}, false
+}
+
+// Load "*.json" template files from directory
+func (s *Store) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var file templateFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if file.ID == "" {
+			file.ID = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if !IsValidID(file.ID) {
+			return fmt.Errorf("%s: invalid template id %q", path, file.ID)
+		}
+		if file.Generation == "" {
+			file.Generation = GenerationLegacy
+			if strings.HasPrefix(file.ID, "d-") {
+				file.Generation = GenerationDynamic
+			}
+		}
+
+		version := Version{
+			Name:         file.Name,
+			Subject:      file.Subject,
+			HTMLContent:  file.HTMLContent,
+			PlainContent: file.PlainContent,
+			Active:       1,
+		}
+		if err := Parse(version); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		s.put(Template{
+			ID:         file.ID,
+			Name:       file.Name,
+			Generation: file.Generation,
+			UpdatedAt:  time.Now().UTC().Format(timeFormat),
+		})
+		if _, err := s.AddVersion(file.ID, version); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) put(template Template) Template {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates[template.ID] = &template
+	return copyTemplate(&template)
+}
+
+// Check template_id format (dynamic "d-..." or legacy GUID)
+func IsValidID(id string) bool {
+	return dynamicIDPattern.MatchString(id) || legacyIDPattern.MatchString(id)
+}
+
+// Parse Handlebars of subject, html and plain content
+func Parse(version Version) error {
+	for _, source := range []string{version.Subject, version.HTMLContent, version.PlainContent} {
+		if _, err := raymond.Parse(source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render Handlebars subject, html and plain content with dynamic_template_data
+func (version Version) Render(data map[string]interface{}) (subject string, html string, text string, err error) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	if subject, err = raymond.Render(version.Subject, data); err != nil {
+		return
+	}
+	if html, err = raymond.Render(version.HTMLContent, data); err != nil {
+		return
+	}
+	text, err = raymond.Render(version.PlainContent, data)
+	return
+}
+
+func findVersion(template *Template, versionID string) int {
+	for i, version := range template.Versions {
+		if version.ID == versionID {
+			return i
+		}
+	}
+	return -1
+}
+
+func copyTemplate(template *Template) Template {
+	t := *template
+	t.Versions = append([]Version{}, template.Versions...)
+	return t
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
@@ -0,0 +1,71 @@
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Error of a token which was not signed with the key
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Link types of the url_offset of click events
+const (
+	TypeHTML = "html"
+	TypeText = "text"
+)
+
+// Token of the click and open tracking URLs in a message
+type Token struct {
+	Email     string `json:"e"`
+	MessageID string `json:"m"`
+	URL       string `json:"u,omitempty"`
+	Index     int    `json:"i,omitempty"`
+	Type      string `json:"t,omitempty"`
+}
+
+// Encode token for URL, signed with key
+func (token Token) Encode(key []byte) string {
+	data, _ := json.Marshal(token)
+	return Sign(key, data)
+}
+
+// Decode token from URL. Tokens which were not signed with key are rejected.
+func ParseToken(s string, key []byte) (Token, error) {
+	var token Token
+	data, err := Verify(key, s)
+	if err != nil {
+		return token, err
+	}
+	err = json.Unmarshal(data, &token)
+	return token, err
+}
+
+// Sign data as "<data>.<HMAC-SHA256 of data>" in base64url
+func Sign(key []byte, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Get data of s signed by Sign with key
+func Verify(key []byte, s string) ([]byte, error) {
+	encoded, signature, _ := strings.Cut(s, ".")
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+	return data, nil
+}
@@ -0,0 +1,385 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+)
+
+// Event in the SendGrid Event Webhook format.
+// custom_args are flattened into the event like SendGrid does.
+type Event map[string]interface{}
+
+// Events which can be generated for a message
+var EventTypes = []string{
+	"processed", "dropped", "deferred", "delivered", "bounce",
+	"open", "click", "spamreport", "unsubscribe", "group_unsubscribe", "group_resubscribe",
+}
+
+type Dispatcher struct {
+	mu      sync.Mutex
+	pending []Event
+	history []Event
+	// history by sg_message_id
+	byMessage map[string][]Event
+	timer     *time.Timer
+	stopped   bool
+	client    *http.Client
+	signer    *Signer
+	listeners []func(Event)
+	// Get SENDGRID_DEV_EVENT_WEBHOOK_* settings
+	getenv func(key string) string
+}
+
+// Default dispatcher used by mail/send, configured by the environment variables
+var Default = NewDispatcher(DefaultSigner, os.Getenv)
+
+// Create dispatcher which signs with signer and gets the settings with getenv
+func NewDispatcher(signer *Signer, getenv func(key string) string) *Dispatcher {
+	return &Dispatcher{client: &http.Client{Timeout: 10 * time.Second}, signer: signer, getenv: getenv}
+}
+
+// Get signer of the Signed Event Webhook
+func (d *Dispatcher) Signer() *Signer {
+	return d.signer
+}
+
+// Create event of message for the recipient
+func NewEvent(eventType string, message messages.Message, email string, fields map[string]interface{}) Event {
+	event := Event{}
+	for key, value := range message.CustomArgs {
+		event[key] = value
+	}
+
+	event["email"] = email
+	event["timestamp"] = time.Now().Unix()
+	event["event"] = eventType
+	event["sg_event_id"] = newEventID()
+	event["sg_message_id"] = message.ID
+	event["smtp-id"] = message.SMTPID
+	switch len(message.Categories) {
+	case 0:
+	case 1:
+		event["category"] = message.Categories[0]
+	default:
+		event["category"] = message.Categories
+	}
+
+	switch eventType {
+	case "delivered":
+		event["response"] = "250 OK"
+		event["ip"] = "127.0.0.1"
+		event["tls"] = 1
+	case "deferred":
+		event["response"] = "400 try again later"
+		event["attempt"] = "1"
+	case "bounce":
+		event["reason"] = "500 unknown recipient"
+		event["status"] = "5.0.0"
+		event["type"] = "bounce"
+		event["bounce_classification"] = "Invalid Address"
+	case "dropped":
+		event["reason"] = "Bounced Address"
+	case "open":
+		event["useragent"] = "Mozilla/5.0"
+		event["ip"] = "127.0.0.1"
+		event["sg_machine_open"] = false
+	case "click":
+		event["useragent"] = "Mozilla/5.0"
+		event["ip"] = "127.0.0.1"
+		event["url"] = firstURL(message)
+		event["url_offset"] = map[string]interface{}{"index": 0, "type": "html"}
+	}
+
+	for key, value := range fields {
+		event[key] = value
+	}
+	return event
+}
+
+// Get time of event
+func (e Event) Time() time.Time {
+	switch timestamp := e["timestamp"].(type) {
+	case int64:
+		return time.Unix(timestamp, 0)
+	case int:
+		return time.Unix(int64(timestamp), 0)
+	case float64:
+		return time.Unix(int64(timestamp), 0)
+	}
+	return time.Time{}
+}
+
+// Create events of message for every recipient
+func NewEvents(eventType string, message messages.Message, fields map[string]interface{}) []Event {
+	events := []Event{}
+	for _, list := range [][]messages.Address{message.To, message.Cc, message.Bcc} {
+		for _, address := range list {
+			events = append(events, NewEvent(eventType, message, address.Email, fields))
+		}
+	}
+	return events
+}
+
+// Check event type
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish events of an accepted message.
+// "processed" is published immediately, the others after SENDGRID_DEV_EVENT_WEBHOOK_DELAY.
+func (d *Dispatcher) PublishAccepted(message messages.Message) {
+	var delayed []Event
+	for _, eventType := range d.EventTypes() {
+		events := NewEvents(eventType, message, nil)
+		if eventType == "processed" {
+			d.Publish(events...)
+		} else {
+			delayed = append(delayed, events...)
+		}
+	}
+	if len(delayed) == 0 {
+		return
+	}
+
+	delay := d.getDuration("SENDGRID_DEV_EVENT_WEBHOOK_DELAY", 0)
+	if delay == 0 {
+		d.Publish(delayed...)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		for _, event := range delayed {
+			event["timestamp"] = time.Now().Unix()
+		}
+		d.Publish(delayed...)
+	})
+}
+
+// Publish events. Events are posted in batches of SENDGRID_DEV_EVENT_WEBHOOK_BATCH_SIZE
+// or after SENDGRID_DEV_EVENT_WEBHOOK_BATCH_INTERVAL.
+func (d *Dispatcher) Publish(events ...Event) {
+	d.mu.Lock()
+	d.history = append(d.history, events...)
+	d.index(events)
+	if d.getenv("SENDGRID_DEV_EVENT_WEBHOOK_URL") != "" && !d.stopped {
+		d.pending = append(d.pending, events...)
+		if len(d.pending) >= d.getBatchSize() {
+			go d.Flush()
+		} else if d.timer == nil {
+			d.timer = time.AfterFunc(d.getDuration("SENDGRID_DEV_EVENT_WEBHOOK_BATCH_INTERVAL", time.Second), d.Flush)
+		}
+	}
+	// Listeners are called without the lock, so that they can call the dispatcher
+	listeners := append([]func(Event){}, d.listeners...)
+	d.mu.Unlock()
+
+	for _, event := range events {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
+
+// Get all published events
+func (d *Dispatcher) Snapshot() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Event{}, d.history...)
+}
+
+// Replace the published events without posting them
+func (d *Dispatcher) Restore(events []Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.history = append([]Event{}, events...)
+	d.byMessage = nil
+	d.index(d.history)
+}
+
+// Delete published events before t
+func (d *Dispatcher) DeleteBefore(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	history := []Event{}
+	for _, event := range d.history {
+		if !event.Time().Before(t) {
+			history = append(history, event)
+		}
+	}
+	d.history = history
+	d.byMessage = nil
+	d.index(d.history)
+}
+
+// Call listener with every published event. listener is called without the lock, so it may call the dispatcher.
+func (d *Dispatcher) Listen(listener func(Event)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.listeners = append(d.listeners, listener)
+}
+
+// Post pending events to SENDGRID_DEV_EVENT_WEBHOOK_URL
+func (d *Dispatcher) Flush() {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	batches := [][]Event{}
+	for size := d.getBatchSize(); len(d.pending) > 0; {
+		n := size
+		if len(d.pending) < n {
+			n = len(d.pending)
+		}
+		batches = append(batches, d.pending[:n])
+		d.pending = d.pending[n:]
+	}
+	d.mu.Unlock()
+
+	for _, batch := range batches {
+		if err := d.post(d.getenv("SENDGRID_DEV_EVENT_WEBHOOK_URL"), batch); err != nil {
+			fmt.Println("Post event webhook failed.", err)
+		}
+	}
+}
+
+// Stop the batch timer and discard the pending events. Events published later are not posted.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+	d.pending = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// Get published events of the message
+func (d *Dispatcher) History(messageID string) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Event{}, d.byMessage[messageID]...)
+}
+
+// Add events to byMessage. d.mu must be held.
+func (d *Dispatcher) index(events []Event) {
+	if d.byMessage == nil {
+		d.byMessage = map[string][]Event{}
+	}
+	for _, event := range events {
+		id, _ := event["sg_message_id"].(string)
+		d.byMessage[id] = append(d.byMessage[id], event)
+	}
+}
+
+func (d *Dispatcher) post(url string, batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "SendGrid Event API")
+	if d.signer.Enabled() {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signed := body
+		if d.getenv("SENDGRID_DEV_EVENT_WEBHOOK_INVALID_SIGNATURE") == "1" {
+			// Sign another payload to test rejection by the receiver
+			signed = append([]byte("invalid"), body...)
+		}
+		signature, err := d.signer.Sign(timestamp, signed)
+		if err != nil {
+			return err
+		}
+		request.Header.Set(SignatureHeader, signature)
+		request.Header.Set(TimestampHeader, timestamp)
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", url, response.Status)
+	}
+	return nil
+}
+
+// Get event types from SENDGRID_DEV_EVENT_WEBHOOK_EVENTS ("processed,delivered" by default)
+func (d *Dispatcher) EventTypes() []string {
+	value := d.getenv("SENDGRID_DEV_EVENT_WEBHOOK_EVENTS")
+	if value == "" {
+		value = "processed,delivered"
+	}
+
+	eventTypes := []string{}
+	for _, eventType := range strings.Split(value, ",") {
+		if eventType = strings.TrimSpace(eventType); IsEventType(eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	return eventTypes
+}
+
+func (d *Dispatcher) getBatchSize() int {
+	size, err := strconv.Atoi(d.getenv("SENDGRID_DEV_EVENT_WEBHOOK_BATCH_SIZE"))
+	if err != nil || size <= 0 {
+		return 100
+	}
+	return size
+}
+
+func (d *Dispatcher) getDuration(key string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(d.getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return duration
+}
+
+func firstURL(message messages.Message) string {
+	for _, content := range []string{message.HTML, message.Text} {
+		if i := strings.Index(content, "http"); i >= 0 {
+			url := content[i:]
+			if j := strings.IndexAny(url, " \t\r\n\"'<>"); j >= 0 {
+				url = url[:j]
+			}
+			return url
+		}
+	}
+	return ""
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -2,18 +2,178 @@ package route
 
 import (
 	"github.com/labstack/echo"
+	"github.com/yKanazawa/sendgrid-dev/api/auth"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/clock"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/stream"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/tracking"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/ui"
+	"github.com/yKanazawa/sendgrid-dev/api/dev/unsubscribe"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/apikeys"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/asm"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/mail/batch"
 	"github.com/yKanazawa/sendgrid-dev/api/v3/mail/send"
+	v3messages "github.com/yKanazawa/sendgrid-dev/api/v3/messages"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/stats"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/subusers"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/suppression"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/templates"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/user/scheduledsends"
+	"github.com/yKanazawa/sendgrid-dev/api/v3/user/webhooks"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	model "github.com/yKanazawa/sendgrid-dev/model/v3/suppression"
 )
 
+// Create router of the default instance, configured by the environment variables
 func Init() *echo.Echo {
+	return New(instance.Default)
+}
+
+// Create router whose handlers work on the stores and the settings of instance
+func New(inst *instance.Instance) *echo.Echo {
 	e := echo.New()
+	e.Use(instance.Middleware(inst))
 
 	// Routes
 	v3 := e.Group("/v3/mail")
 	{
 		v3.GET("/send", send.GetSend())
 		v3.POST("/send", send.PostSend())
+		v3.POST("/batch", batch.PostBatch())
+		v3.GET("/batch/:batch_id", batch.GetBatch())
+	}
+
+	v3Templates := e.Group("/v3/templates")
+	{
+		v3Templates.POST("", templates.PostTemplate())
+		v3Templates.GET("", templates.GetTemplates())
+		v3Templates.GET("/:template_id", templates.GetTemplate())
+		v3Templates.PATCH("/:template_id", templates.PatchTemplate())
+		v3Templates.DELETE("/:template_id", templates.DeleteTemplate())
+		v3Templates.POST("/:template_id/versions", templates.PostVersion())
+		v3Templates.GET("/:template_id/versions/:version_id", templates.GetVersion())
+		v3Templates.PATCH("/:template_id/versions/:version_id", templates.PatchVersion())
+		v3Templates.DELETE("/:template_id/versions/:version_id", templates.DeleteVersion())
+		v3Templates.POST("/:template_id/versions/:version_id/activate", templates.PostActivateVersion())
+	}
+
+	v3APIKeys := e.Group("/v3/api_keys")
+	{
+		v3APIKeys.POST("", apikeys.PostAPIKey())
+		v3APIKeys.GET("", apikeys.GetAPIKeys())
+		v3APIKeys.GET("/:api_key_id", apikeys.GetAPIKey())
+		v3APIKeys.PUT("/:api_key_id", apikeys.PutAPIKey())
+		v3APIKeys.PATCH("/:api_key_id", apikeys.PatchAPIKey())
+		v3APIKeys.DELETE("/:api_key_id", apikeys.DeleteAPIKey())
+	}
+
+	v3Subusers := e.Group("/v3/subusers")
+	{
+		v3Subusers.POST("", subusers.PostSubuser())
+		v3Subusers.GET("", subusers.GetSubusers())
+		v3Subusers.GET("/:subuser_name", subusers.GetSubuser())
+		v3Subusers.PATCH("/:subuser_name", subusers.PatchSubuser())
+		v3Subusers.DELETE("/:subuser_name", subusers.DeleteSubuser())
 	}
 
+	v3Messages := e.Group("/v3/messages")
+	{
+		v3Messages.GET("", v3messages.GetMessages())
+		v3Messages.GET("/:msg_id", v3messages.GetMessage())
+	}
+
+	v3Stats := e.Group("/v3")
+	{
+		v3Stats.GET("/stats", stats.GetStats())
+		v3Stats.GET("/categories/stats", stats.GetCategoryStats())
+		v3Stats.GET("/categories/stats/sums", stats.GetCategoryStatsSums())
+		v3Stats.GET("/mailbox_providers/stats", stats.GetMailboxProviderStats())
+		v3Stats.GET("/geo/stats", stats.GetGeoStats())
+	}
+
+	v3Webhooks := e.Group("/v3/user/webhooks")
+	{
+		v3Webhooks.GET("/event/settings/signed", webhooks.GetSigned())
+		v3Webhooks.PATCH("/event/settings/signed", webhooks.PatchSigned())
+	}
+
+	v3ScheduledSends := e.Group("/v3/user/scheduled_sends")
+	{
+		v3ScheduledSends.POST("", scheduledsends.PostScheduledSend())
+		v3ScheduledSends.GET("", scheduledsends.GetScheduledSends())
+		v3ScheduledSends.GET("/:batch_id", scheduledsends.GetScheduledSend())
+		v3ScheduledSends.PATCH("/:batch_id", scheduledsends.PatchScheduledSend())
+		v3ScheduledSends.DELETE("/:batch_id", scheduledsends.DeleteScheduledSend())
+	}
+
+	for _, list := range model.Lists {
+		v3Suppression := e.Group("/v3/suppression/" + list)
+		{
+			v3Suppression.GET("", suppression.GetSuppressions(list))
+			v3Suppression.POST("", suppression.PostSuppressions(list))
+			v3Suppression.DELETE("", suppression.DeleteSuppressions(list))
+			v3Suppression.GET("/:email", suppression.GetSuppression(list))
+			v3Suppression.DELETE("/:email", suppression.DeleteSuppression(list))
+		}
+	}
+
+	v3ASM := e.Group("/v3/asm")
+	{
+		v3ASM.POST("/groups", asm.PostGroup())
+		v3ASM.GET("/groups", asm.GetGroups())
+		v3ASM.GET("/groups/:group_id", asm.GetGroup())
+		v3ASM.PATCH("/groups/:group_id", asm.PatchGroup())
+		v3ASM.DELETE("/groups/:group_id", asm.DeleteGroup())
+		v3ASM.POST("/groups/:group_id/suppressions", asm.PostGroupSuppressions())
+		v3ASM.GET("/groups/:group_id/suppressions", asm.GetGroupSuppressions())
+		v3ASM.DELETE("/groups/:group_id/suppressions/:email", asm.DeleteGroupSuppression())
+		v3ASM.POST("/suppressions/global", asm.PostGlobalSuppressions())
+		v3ASM.GET("/suppressions/global/:email", asm.GetGlobalSuppression())
+		v3ASM.DELETE("/suppressions/global/:email", asm.DeleteGlobalSuppression())
+	}
+
+	dev := e.Group("/dev/messages", auth.DevSubuser())
+	{
+		dev.GET("", messages.GetMessages())
+		dev.DELETE("", messages.DeleteMessages())
+		dev.GET("/stream", stream.GetStream())
+		dev.GET("/export", messages.GetMessagesExport())
+		dev.GET("/:id", messages.GetMessage())
+		dev.GET("/:id/raw", messages.GetMessageRaw())
+		dev.GET("/:id/eml", messages.GetMessageEML())
+		dev.GET("/:id/html", messages.GetMessageHTML())
+		dev.GET("/:id/headers", messages.GetMessageHeaders())
+		dev.GET("/:id/attachments", messages.GetMessageAttachments())
+		dev.GET("/:id/attachments/:index", messages.GetMessageAttachment())
+		dev.GET("/:id/request", messages.GetMessageRequest())
+		dev.DELETE("/:id", messages.DeleteMessage())
+		dev.GET("/:id/events", messages.GetMessageEvents())
+		dev.POST("/:id/events", messages.PostMessageEvents())
+	}
+
+	devASM := e.Group("/dev/asm")
+	{
+		devASM.GET("/unsubscribe", unsubscribe.GetUnsubscribe())
+		devASM.GET("/preferences", unsubscribe.GetPreferences())
+		devASM.POST("/preferences", unsubscribe.PostPreferences())
+	}
+
+	devTrack := e.Group("/dev/track")
+	{
+		devTrack.GET("/click", tracking.GetClick())
+		devTrack.GET("/open", tracking.GetOpen())
+	}
+
+	devClock := e.Group("/dev/clock")
+	{
+		devClock.GET("", clock.GetClock())
+		devClock.DELETE("", clock.DeleteClock())
+		devClock.POST("/advance", clock.PostAdvance())
+	}
+
+	e.GET("/", ui.GetIndex("/dev/ui/"))
+	e.GET("/dev/ui", ui.GetIndex("/dev/ui/"))
+	e.GET("/dev/ui/*", ui.GetUI("/dev/ui/"))
+
 	return e
 }
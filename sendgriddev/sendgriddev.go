@@ -0,0 +1,175 @@
+// Package sendgriddev runs the sendgrid-dev API in the test process.
+//
+// Every Server has its own settings and stores, so tests with servers can run with t.Parallel():
+//
+//	server := sendgriddev.NewServer(sendgriddev.Options{})
+//	defer server.Close()
+//	// Send with server.URL as the SendGrid API host and server.APIKey
+//	message := server.AssertSent(t, sendgriddev.Filter{To: "to@example.com"})
+package sendgriddev
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yKanazawa/sendgrid-dev/model/dev/instance"
+	"github.com/yKanazawa/sendgrid-dev/model/dev/messages"
+	"github.com/yKanazawa/sendgrid-dev/model/v3/webhook"
+	"github.com/yKanazawa/sendgrid-dev/route"
+)
+
+// Default API key with full access
+const DefaultAPIKey = "SG.sendgrid-dev"
+
+// Message accepted by /v3/mail/send, one per personalization
+type Message = messages.Message
+
+// Address of a message
+type Address = messages.Address
+
+// Filter of messages. Empty fields match every message.
+type Filter = messages.Filter
+
+// Event in the SendGrid Event Webhook format
+type Event = webhook.Event
+
+// Options of Server. The zero value keeps accepted messages in the server only.
+type Options struct {
+	// API key with full access (DefaultAPIKey when empty)
+	APIKey string
+	// Transports of accepted messages like SENDGRID_DEV_TRANSPORT ("store" when empty)
+	Transport string
+	// URL to post events to (no posts when empty)
+	EventWebhookURL string
+	// Event types generated for accepted messages ("processed" and "delivered" when empty)
+	EventWebhookEvents []string
+	// Other settings by the name of the environment variable, e.g. "SENDGRID_DEV_SMTP_SERVER".
+	// The environment variables of the process are not used.
+	Env map[string]string
+}
+
+// Server is an httptest.Server of the sendgrid-dev API
+type Server struct {
+	*httptest.Server
+	// API key with full access
+	APIKey string
+
+	instance *instance.Instance
+}
+
+// Start server. Close it when the test ends.
+func NewServer(opts Options) *Server {
+	env := map[string]string{}
+	for key, value := range opts.Env {
+		env[key] = value
+	}
+	apiKey := opts.APIKey
+	if apiKey == "" {
+		apiKey = DefaultAPIKey
+	}
+	env["SENDGRID_DEV_API_KEY"] = apiKey
+	if opts.Transport != "" {
+		env["SENDGRID_DEV_TRANSPORT"] = opts.Transport
+	} else if env["SENDGRID_DEV_TRANSPORT"] == "" {
+		env["SENDGRID_DEV_TRANSPORT"] = "store"
+	}
+	if opts.EventWebhookURL != "" {
+		env["SENDGRID_DEV_EVENT_WEBHOOK_URL"] = opts.EventWebhookURL
+	}
+	if len(opts.EventWebhookEvents) > 0 {
+		env["SENDGRID_DEV_EVENT_WEBHOOK_EVENTS"] = strings.Join(opts.EventWebhookEvents, ",")
+	}
+
+	inst := instance.New(func(key string) string {
+		return env[key]
+	})
+	server := httptest.NewUnstartedServer(route.New(inst))
+	if env["SENDGRID_DEV_PUBLIC_URL"] == "" {
+		// Tracking and unsubscribe links point to this server
+		env["SENDGRID_DEV_PUBLIC_URL"] = "http://" + server.Listener.Addr().String()
+	}
+	server.Start()
+
+	return &Server{Server: server, APIKey: apiKey, instance: inst}
+}
+
+// Close server and stop the timers of the scheduled messages and the event webhook
+func (s *Server) Close() {
+	s.Server.Close()
+	s.instance.Scheduler.Stop()
+	s.instance.Dispatcher.Stop()
+}
+
+// Get accepted messages matching filter, oldest first
+func (s *Server) Messages(filter Filter) []Message {
+	return s.instance.Messages.List(filter)
+}
+
+// Get message by ID (sg_message_id)
+func (s *Server) Message(id string) (Message, bool) {
+	return s.instance.Messages.Get(id)
+}
+
+// Get published events of the message, oldest first
+func (s *Server) Events(messageID string) []Event {
+	return s.instance.Dispatcher.History(messageID)
+}
+
+// Advance the clock of the scheduler and send the scheduled messages which became due
+func (s *Server) AdvanceClock(d time.Duration) {
+	s.instance.Scheduler.Advance(d)
+}
+
+// Delete the messages, their events and the email activity
+func (s *Server) Reset() {
+	s.instance.Messages.DeleteAll()
+	s.instance.Dispatcher.Restore(nil)
+	s.instance.Activity.DeleteAll()
+}
+
+// Fail t unless a message matches filter. Returns the newest matching message.
+func (s *Server) AssertSent(t testing.TB, filter Filter) Message {
+	t.Helper()
+
+	list := s.Messages(filter)
+	if len(list) == 0 {
+		t.Fatalf("no message matches %+v in %d messages", filter, len(s.Messages(Filter{})))
+	}
+	return list[len(list)-1]
+}
+
+// Fail t if a message matches filter
+func (s *Server) AssertNotSent(t testing.TB, filter Filter) {
+	t.Helper()
+
+	if list := s.Messages(filter); len(list) > 0 {
+		t.Errorf("%d messages match %+v, first %q to %v", len(list), filter, list[0].Subject, list[0].To)
+	}
+}
+
+// Fail t unless n messages match filter. Returns the matching messages.
+func (s *Server) AssertMessageCount(t testing.TB, filter Filter, n int) []Message {
+	t.Helper()
+
+	list := s.Messages(filter)
+	if len(list) != n {
+		t.Errorf("%d messages match %+v, want %d", len(list), filter, n)
+	}
+	return list
+}
+
+// Fail t unless the message has an event of eventType. Returns the event.
+func (s *Server) AssertEvent(t testing.TB, messageID string, eventType string) Event {
+	t.Helper()
+
+	events := s.Events(messageID)
+	for _, event := range events {
+		if event["event"] == eventType {
+			return event
+		}
+	}
+	t.Fatalf("message %s has no %q event in %d events", messageID, eventType, len(events))
+	return nil
+}